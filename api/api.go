@@ -28,6 +28,7 @@ type (
 	RunTestsV2Config = leapi.RunTestsV2Config
 	TestReport       = leapi.TestReport
 	TIConfig         = leapi.TIConfig
+	BuildConfig      = spec.BuildConfig
 )
 
 type (
@@ -37,6 +38,16 @@ type (
 		GitInstalled    bool   `json:"git_installed"`
 		LiteEngineLog   string `json:"lite_engine_log"`
 		OK              bool   `json:"ok"`
+
+		// LogSpool is the size of the spool of logs that could
+		// not be delivered. It is nil if spooling is disabled.
+		LogSpool *LogSpoolStats `json:"log_spool,omitempty"`
+	}
+
+	// LogSpoolStats provides the size of the log spool.
+	LogSpoolStats struct {
+		Uploads int   `json:"uploads"`
+		Bytes   int64 `json:"bytes"`
 	}
 
 	SetupRequest struct {
@@ -60,6 +71,7 @@ type (
 		MountDockerSocket *bool             `json:"mount_docker_socket,omitempty"`
 		CorrelationID     string            `json:"correlation_id"`
 		LogKey            string            `json:"log_key"`
+		Auths             []*spec.Auth      `json:"auths,omitempty"` // registry credentials of the stage
 	}
 
 	SetupResponse struct {
@@ -95,12 +107,17 @@ type (
 		Run        RunConfig         `json:"run,omitempty"`
 		RunTest    RunTestConfig     `json:"run_test,omitempty"`
 		RunTestsV2 RunTestsV2Config  `json:"run_test_v2,omitempty"`
+		Build      BuildConfig       `json:"build,omitempty"`
+		Plugin     PluginConfig      `json:"plugin,omitempty"`
+		Action     HostPluginConfig  `json:"action,omitempty"`
+		Bitrise    HostPluginConfig  `json:"bitrise,omitempty"`
 
-		OutputVars        []string    `json:"output_vars,omitempty"`
-		TestReport        TestReport  `json:"test_report,omitempty"`
-		Timeout           int         `json:"timeout,omitempty"` // step timeout in seconds
-		MountDockerSocket *bool       `json:"mount_docker_socket"`
-		Outputs           []*OutputV2 `json:"outputs,omitempty"`
+		OutputVars        []string     `json:"output_vars,omitempty"`
+		TestReport        TestReport   `json:"test_report,omitempty"`
+		Timeout           int          `json:"timeout,omitempty"` // step timeout in seconds
+		MountDockerSocket *bool        `json:"mount_docker_socket"`
+		Outputs           []*OutputV2  `json:"outputs,omitempty"`
+		RetryPolicy       *RetryPolicy `json:"retry_policy,omitempty"`
 
 		// Valid only for steps running on docker container
 		Auth         *spec.Auth           `json:"auth,omitempty"`
@@ -112,15 +129,17 @@ type (
 		DNS          []string             `json:"dns,omitempty"`
 		DNSSearch    []string             `json:"dns_search,omitempty"`
 		ExtraHosts   []string             `json:"extra_hosts,omitempty"`
-		IgnoreStdout bool                 `json:"ignore_stderr,omitempty"`
-		IgnoreStderr bool                 `json:"ignore_stdout,omitempty"`
+		IgnoreStdout bool                 `json:"ignore_stdout,omitempty"`
+		IgnoreStderr bool                 `json:"ignore_stderr,omitempty"`
 		Image        string               `json:"image,omitempty"`
+		Platform     string               `json:"platform,omitempty"` // Target platform of the image, eg linux/arm64
 		Labels       map[string]string    `json:"labels,omitempty"`
 		MemSwapLimit int64                `json:"memswap_limit,omitempty"`
 		MemLimit     int64                `json:"mem_limit,omitempty"`
 		Network      string               `json:"network,omitempty"`
 		Networks     []string             `json:"networks,omitempty"`
-		PortBindings map[string]string    `json:"port_bindings,omitempty"` // Host port to container port mapping
+		PidsLimit    int64                `json:"pids_limit,omitempty"`
+		PortBindings map[string]string    `json:"port_bindings,omitempty"` // Host port to container port mapping, host port 0 or auto is allocated by the runner
 		Privileged   bool                 `json:"privileged,omitempty"`
 		Pull         spec.PullPolicy      `json:"pull,omitempty"`
 		ShmSize      int64                `json:"shm_size,omitempty"`
@@ -130,6 +149,16 @@ type (
 		SoftStop     bool                 `json:"soft_stop,omitempty"`
 	}
 
+	// RetryPolicy configures when a failed step is executed again.
+	RetryPolicy struct {
+		MaxAttempts   int     `json:"max_attempts,omitempty"`   // total number of attempts, including the first one
+		Backoff       int     `json:"backoff,omitempty"`        // seconds to wait before the first retry
+		BackoffFactor float64 `json:"backoff_factor,omitempty"` // multiplier applied to the wait after every retry
+		MaxBackoff    int     `json:"max_backoff,omitempty"`    // maximum seconds to wait between attempts
+		ExitCodes     []int   `json:"exit_codes,omitempty"`     // step exit codes that are retried
+		InfraErrors   bool    `json:"infra_errors,omitempty"`   // retry when the step could not be run, eg image pull or container start failures
+	}
+
 	OutputV2 struct {
 		Key   string     `json:"key,omitempty"`
 		Value string     `json:"value,omitempty"`
@@ -173,6 +202,11 @@ type (
 		OutputV2          []*OutputV2          `json:"outputV2,omitempty"`
 		OptimizationState string               `json:"optimization_state,omitempty"`
 		Telemetry         *types.TelemetryData `json:"telemetry,omitempty"`
+		Image             *ImageTelemetry      `json:"image_telemetry,omitempty"`
+		Log               *LogTelemetry        `json:"log_telemetry,omitempty"`
+		Nudges            []*Nudge             `json:"nudges,omitempty"`
+		Attempts          int                  `json:"attempts,omitempty"`
+		AttemptExitCodes  []int                `json:"attempt_exit_codes,omitempty"`
 	}
 
 	StreamOutputRequest struct {
@@ -191,6 +225,90 @@ type (
 		URL               string `json:"url,omitempty"`
 		Token             string `json:"token,omitempty"`
 		TrimNewLineSuffix bool   `json:"trim_new_line_suffix,omitempty"`
+		ShowTimestamps    bool   `json:"show_timestamps,omitempty"` // Whether to prepend the time each line was produced
+		Compress          bool   `json:"compress,omitempty"`        // Whether to gzip the uploads to the log service, which must accept gzip encoded requests
+
+		// DisableSecretDetection disables masking the credentials
+		// matched by the secret rules of the runner. Explicit
+		// secrets are still masked.
+		DisableSecretDetection bool `json:"disable_secret_detection,omitempty"`
+
+		// Limit is the maximum size in bytes of the logs of a step
+		// that are uploaded. If the logs exceed the limit, the first
+		// HeadLimit bytes and the last bytes up to the limit are
+		// kept. Defaults to 5MB and a fifth of the limit.
+		Limit     int `json:"limit,omitempty"`
+		HeadLimit int `json:"head_limit,omitempty"`
+
+		// S3 archives the logs in an S3 compatible object store
+		// instead of the log service.
+		S3 *S3LogConfig `json:"s3,omitempty"`
+
+		// Sinks selects the sinks the logs are written to: remote
+		// (the log service), s3 or file (stored on the runner). If
+		// empty, the logs are written to the object store if it is
+		// configured, else to the log service if it is configured,
+		// else stored on the runner.
+		Sinks []string `json:"sinks,omitempty"`
+	}
+
+	// S3LogConfig configures the object store the logs are archived in.
+	S3LogConfig struct {
+		Endpoint        string `json:"endpoint,omitempty"`
+		Region          string `json:"region,omitempty"`
+		Bucket          string `json:"bucket,omitempty"`
+		Prefix          string `json:"prefix,omitempty"`
+		AccessKeyID     string `json:"access_key_id,omitempty"`
+		SecretAccessKey string `json:"secret_access_key,omitempty"`
+		SessionToken    string `json:"session_token,omitempty"`
+		PathStyle       bool   `json:"path_style,omitempty"`
+	}
+
+	// ImageTelemetry describes the image the step container was
+	// created from.
+	ImageTelemetry struct {
+		Image          string `json:"image,omitempty"`
+		Platform       string `json:"platform,omitempty"`
+		Digest         string `json:"digest,omitempty"`
+		Pulled         bool   `json:"pulled,omitempty"`
+		PullDurationMs int64  `json:"pull_duration_ms,omitempty"`
+		PullBytes      int64  `json:"pull_bytes,omitempty"`
+		PullLayers     int    `json:"pull_layers,omitempty"`
+	}
+
+	// LogTelemetry describes the logs of the step.
+	LogTelemetry struct {
+		MaskedSecrets  int `json:"masked_secrets,omitempty"`  // number of masked occurrences of secrets and credentials
+		TruncatedLines int `json:"truncated_lines,omitempty"` // number of lines dropped from the uploaded logs
+		TruncatedBytes int `json:"truncated_bytes,omitempty"` // size of the lines dropped from the uploaded logs
+
+		// SinkErrors is the last error of each log sink that
+		// failed, if the logs are written to several sinks.
+		SinkErrors map[string]string `json:"sink_errors,omitempty"`
+	}
+
+	// Nudge is a known problem whose search term was found in the
+	// logs of the step, with its possible resolution.
+	Nudge struct {
+		Error      string `json:"error"`
+		Resolution string `json:"resolution,omitempty"`
+		Severity   string `json:"severity"`
+		Line       int    `json:"line"` // line number, starting at 1
+		Log        string `json:"log"`
+	}
+
+	// PluginConfig configures a drone plugin step. The settings are
+	// passed to the plugin image as PLUGIN_ environment variables.
+	PluginConfig struct {
+		Settings map[string]interface{} `json:"settings,omitempty"`
+		Secrets  []*spec.Secret         `json:"secrets,omitempty"` // secrets referenced by the settings with from_secret
+	}
+
+	// HostPluginConfig configures a GitHub Action or Bitrise step
+	// that is run on the host with the plugin binary.
+	HostPluginConfig struct {
+		Uses string            `json:"uses,omitempty"`
+		With map[string]string `json:"with,omitempty"`
 	}
 
 	JunitReport struct {
@@ -204,3 +322,10 @@ const (
 	OutputTypeString OutputType = "STRING"
 	OutputTypeSecret OutputType = "SECRET"
 )
+
+// Log sinks that can be selected in the log config.
+const (
+	LogSinkRemote = "remote"
+	LogSinkS3     = "s3"
+	LogSinkFile   = "file"
+)
@@ -17,6 +17,10 @@ const (
 	Run StepType = iota
 	RunTest
 	RunTestsV2
+	Build
+	Plugin
+	Action
+	Bitrise
 )
 
 func (s StepType) String() string {
@@ -27,6 +31,10 @@ var stepTypeID = map[StepType]string{
 	Run:        "Run",
 	RunTest:    "RunTest",
 	RunTestsV2: "RunTestsV2",
+	Build:      "Build",
+	Plugin:     "Plugin",
+	Action:     "Action",
+	Bitrise:    "Bitrise",
 }
 
 var stepTypeName = map[string]StepType{
@@ -34,6 +42,10 @@ var stepTypeName = map[string]StepType{
 	"Run":        Run,
 	"RunTest":    RunTest,
 	"RunTestsV2": RunTestsV2,
+	"Build":      Build,
+	"Plugin":     Plugin,
+	"Action":     Action,
+	"Bitrise":    Bitrise,
 }
 
 // MarshalJSON marshals the string representation of the
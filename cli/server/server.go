@@ -16,17 +16,29 @@ import (
 	"github.com/harness/harness-docker-runner/config"
 	"github.com/harness/harness-docker-runner/engine"
 	"github.com/harness/harness-docker-runner/engine/docker"
+	"github.com/harness/harness-docker-runner/engine/exec"
 	"github.com/harness/harness-docker-runner/handler"
 	"github.com/harness/harness-docker-runner/logger"
+	"github.com/harness/harness-docker-runner/logstream/filestore"
+	"github.com/harness/harness-docker-runner/pipeline"
 	"github.com/harness/harness-docker-runner/pipeline/runtime"
 	"github.com/harness/harness-docker-runner/server"
 	"github.com/harness/harness-docker-runner/setup"
+	"github.com/harness/harness-docker-runner/tracing"
+	"github.com/harness/harness-docker-runner/version"
 
 	"github.com/harness/godotenv/v3"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// interval at which the retention of the stored logs is applied.
+const logRetentionInterval = 10 * time.Minute
+
+// time allowed to export the pending spans on exit.
+const tracingShutdownTimeout = 5 * time.Second
+
 type serverCommand struct {
 	envfile string
 }
@@ -50,9 +62,37 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 	}
 
 	// init the system logging.
-	initLogging(&loadedConfig)
+	if err := initLogging(&loadedConfig); err != nil {
+		logrus.WithError(err).
+			Errorln("cannot configure the logging")
+		return err
+	}
 
-	engine, err := engine.NewEnv(docker.Opts{})
+	if path := loadedConfig.Log.SecretRulesFile; path != "" {
+		if err := pipeline.LoadSecretRules(path); err != nil {
+			logrus.WithError(err).WithField("path", path).
+				Errorln("cannot load the secret rules")
+			return err
+		}
+	}
+
+	if path := loadedConfig.Log.NudgesFile; path != "" {
+		if err := pipeline.LoadNudges(path); err != nil {
+			logrus.WithError(err).WithField("path", path).
+				Errorln("cannot load the nudges")
+			return err
+		}
+	}
+
+	engine, err := engine.NewEnv(engine.Opts{
+		Docker: docker.Opts{},
+		Exec: exec.Opts{
+			CgroupRoot:   loadedConfig.Runner.HostCgroupRoot,
+			EnvAllowlist: loadedConfig.Runner.HostEnvAllowlist,
+			StrictUser:   loadedConfig.Runner.HostStrictUser,
+			StrictLimits: loadedConfig.Runner.HostStrictLimits,
+		},
+	})
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("failed to initialize engine")
@@ -90,6 +130,48 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 		}
 	}()
 
+	// export the spans of the stages and steps.
+	shutdownTracing, err := tracing.Init(ctx, tracing.Config{
+		Exporter:    loadedConfig.Tracing.Exporter,
+		Endpoint:    loadedConfig.Tracing.Endpoint,
+		Insecure:    loadedConfig.Tracing.Insecure,
+		SampleRatio: loadedConfig.Tracing.SampleRatio,
+		Version:     version.Version,
+	})
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("failed to initialize tracing")
+		return err
+	}
+	defer func() {
+		// the server context is canceled by now.
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.WithError(err).Warnln("failed to flush the spans")
+		}
+	}()
+
+	// replay the logs that could not be delivered before the
+	// runner was restarted.
+	if dir := loadedConfig.Log.SpoolDir; dir != "" {
+		if err := pipeline.StartLogSpool(ctx, dir); err != nil {
+			logrus.WithError(err).WithField("dir", dir).
+				Errorln("failed to start log spool, undelivered logs will be dropped")
+		}
+	}
+
+	if dir := loadedConfig.Log.StoreDir; dir != "" {
+		pipeline.LogStorePath = dir
+	}
+	// remove the logs stored on the runner that exceed the retention.
+	retention := &filestore.Retention{
+		Root:    pipeline.LogStorePath,
+		MaxAge:  loadedConfig.Log.StoreMaxAge,
+		MaxSize: loadedConfig.Log.StoreMaxSize,
+	}
+	go retention.Start(ctx, logRetentionInterval)
+
 	logrus.Infof(fmt.Sprintf("server listening at port %s", loadedConfig.Server.Bind))
 	// run the setup checks / installation
 	if loadedConfig.Server.SkipPrepareServer {
@@ -127,35 +209,65 @@ func Register(app *kingpin.Application) {
 type OutputSplitter struct{}
 
 func (splitter *OutputSplitter) Write(p []byte) (n int, err error) {
-	if bytes.Contains(p, []byte("level=error")) {
+	if bytes.Contains(p, []byte("level=error")) || bytes.Contains(p, []byte(`"level":"error"`)) {
 		return os.Stderr.Write(p)
 	}
 	return os.Stdout.Write(p)
 }
 
 // helper function configures the global logger from the loaded configuration.
-func initLogging(c *config.Config) {
-	logrus.SetOutput(&OutputSplitter{})
+func initLogging(c *config.Config) error {
 	l := logrus.StandardLogger()
 	logger.L = logrus.NewEntry(l)
-	if c.Debug {
-		l.SetLevel(logrus.DebugLevel)
+
+	level, err := logrus.ParseLevel(c.Logging.Level)
+	if err != nil {
+		return err
+	}
+	if c.Debug && level < logrus.DebugLevel {
+		level = logrus.DebugLevel
 	}
 	if c.Trace {
-		l.SetLevel(logrus.TraceLevel)
+		level = logrus.TraceLevel
+	}
+	levels, err := logger.ParseLevels(c.Logging.Levels)
+	if err != nil {
+		return err
 	}
 
-	if RunTime.GOOS == "windows" {
-		dir, _ := os.Getwd()
-		logFilePath := dir + string(os.PathSeparator) + "harness-docker-runner-" + time.Now().Format("2-January-2006") + ".log"
-		logrus.Infoln("Logs will be dumped to : " + logFilePath)
-		file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			logger.L.Logger.Infoln("Failed to open log file:", err)
-		}
+	var formatter logrus.Formatter
+	switch c.Logging.Format {
+	case "text":
+		formatter = &logrus.TextFormatter{CallerPrettyfier: logger.HideCaller}
+	case "json":
+		formatter = &logrus.JSONFormatter{CallerPrettyfier: logger.HideCaller}
+	default:
+		return fmt.Errorf("unknown log format %q", c.Logging.Format)
+	}
+	f := &logger.LevelFormatter{Formatter: formatter, Level: level, Levels: levels}
+	l.SetFormatter(f)
+	l.SetLevel(f.MaxLevel())
+	// the caller resolves the component of the entries, which is
+	// only needed to apply the levels of the components.
+	l.SetReportCaller(len(levels) > 0)
 
-		// Set the logger's output to the file
-		logger.L.Logger.SetOutput(file)
+	path := c.Logging.File
+	if path == "" && RunTime.GOOS == "windows" {
+		dir, _ := os.Getwd()
+		path = dir + string(os.PathSeparator) + "harness-docker-runner-" + time.Now().Format("2-January-2006") + ".log"
+	}
+	if path == "" {
+		l.SetOutput(logger.SkipEmpty(&OutputSplitter{}))
+		return nil
 	}
 
+	logrus.Infoln("Logs will be dumped to : " + path)
+	l.SetOutput(logger.SkipEmpty(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    c.Logging.MaxSize,
+		MaxAge:     c.Logging.MaxAge,
+		MaxBackups: c.Logging.MaxBackups,
+		Compress:   c.Logging.Compress,
+	}))
+	return nil
 }
@@ -5,6 +5,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -14,9 +19,59 @@ type Config struct {
 	Trace      bool   `envconfig:"DRONE_TRACE"`
 	ServerName string `envconfig:"SERVER_NAME" default:"drone"`
 
+	// logs of the runner itself, as opposed to the logs of the steps.
+	Logging struct {
+		// level of the components with no level in Levels. DRONE_DEBUG and DRONE_TRACE raise it.
+		Level string `envconfig:"RUNNER_LOG_LEVEL" default:"info"`
+		// level of the components, eg engine:debug,logstream/remote:trace. A component is a package of the runner.
+		Levels map[string]string `envconfig:"RUNNER_LOG_LEVELS"`
+		// format of the logs, text or json.
+		Format string `envconfig:"RUNNER_LOG_FORMAT" default:"text"`
+		// file the logs are written to instead of stdout, rotated once it reaches MaxSize megabytes.
+		// Rotated files are removed after MaxAge days or once there are more than MaxBackups of them.
+		File       string `envconfig:"RUNNER_LOG_FILE"`
+		MaxSize    int    `envconfig:"RUNNER_LOG_FILE_MAX_SIZE" default:"100"`
+		MaxAge     int    `envconfig:"RUNNER_LOG_FILE_MAX_AGE" default:"7"`
+		MaxBackups int    `envconfig:"RUNNER_LOG_FILE_MAX_BACKUPS" default:"5"`
+		Compress   bool   `envconfig:"RUNNER_LOG_FILE_COMPRESS"`
+	}
+
 	Runner struct {
 		Volumes       []string `envconfig:"CI_MOUNT_VOLUMES"`
 		NetworkDriver string   `envconfig:"NETWORK_DRIVER"`
+
+		// cgroup v2 directory under which resource limits of host steps are applied
+		HostCgroupRoot string `envconfig:"HOST_STEP_CGROUP_ROOT" default:"/sys/fs/cgroup/harness-docker-runner"`
+		// runner environment variables passed to host steps. A trailing * matches by prefix. All are passed if empty.
+		HostEnvAllowlist []string `envconfig:"HOST_STEP_ENV_ALLOWLIST"`
+		// fail host steps with a user on windows, where they otherwise run as the runner user.
+		HostStrictUser bool `envconfig:"HOST_STEP_STRICT_USER"`
+		// fail host steps with resource limits that cannot be applied, where they otherwise run without limits.
+		HostStrictLimits bool `envconfig:"HOST_STEP_STRICT_LIMITS"`
+	}
+
+	Log struct {
+		// directory logs that could not be delivered are spooled in. Spooling is disabled if set to empty.
+		// It persists across restarts, so it should not be cleared like /tmp. Defaults to spool in the data dir.
+		SpoolDir string `envconfig:"LOG_SPOOL_DIR"`
+		// yaml file with the credential rules masked in the logs, in addition to the built-in rules.
+		SecretRulesFile string `envconfig:"LOG_SECRET_RULES_FILE"`
+		// yaml file with the nudges looked for in the logs, in addition to the built-in nudges.
+		NudgesFile string `envconfig:"LOG_NUDGES_FILE"`
+		// directory logs are stored in on the runner if no log service is configured. Defaults to logs in the data dir.
+		StoreDir string `envconfig:"LOG_STORE_DIR"`
+		// retention of the logs stored on the runner if no log service is configured. Zero disables the limit.
+		StoreMaxAge  time.Duration `envconfig:"LOG_STORE_MAX_AGE" default:"168h"`
+		StoreMaxSize int64         `envconfig:"LOG_STORE_MAX_SIZE" default:"1073741824"`
+	}
+
+	Tracing struct {
+		// exporter of the spans, otlp or stdout. Tracing is disabled if empty.
+		Exporter string `envconfig:"TRACING_EXPORTER"`
+		// host:port of the OTLP/HTTP collector. The OTEL_EXPORTER_OTLP_* variables are used if empty.
+		Endpoint    string  `envconfig:"TRACING_OTLP_ENDPOINT"`
+		Insecure    bool    `envconfig:"TRACING_OTLP_INSECURE"`
+		SampleRatio float64 `envconfig:"TRACING_SAMPLE_RATIO" default:"1"`
 	}
 
 	Server struct {
@@ -50,10 +105,32 @@ type Config struct {
 func Load() (Config, error) {
 	cfg := Config{}
 	err := envconfig.Process("", &cfg)
+	if _, ok := os.LookupEnv("LOG_SPOOL_DIR"); !ok {
+		cfg.Log.SpoolDir = dataPath("spool")
+	}
+	if cfg.Log.StoreDir == "" {
+		cfg.Log.StoreDir = dataPath("logs")
+	}
 	conf = &cfg
 	return cfg, err
 }
 
+// helper function returns the path of the file in the directory the
+// runner keeps its data in across restarts. The directory is under
+// /var/lib if the runner runs as root on linux, and under the cache
+// directory of the user otherwise, eg ~/Library/Caches on macOS. It
+// returns an empty path if the directory cannot be determined.
+func dataPath(name string) string {
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 {
+		return filepath.Join("/var/lib/harness-docker-runner", name)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "harness-docker-runner", name)
+}
+
 // Load loads the configuration from the environment.
 func GetConfig() *Config {
 	return conf
@@ -0,0 +1,309 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/drone/runner-go/registry/auths"
+	"github.com/harness/harness-docker-runner/engine/docker/image"
+	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/harness/harness-docker-runner/internal/docker/errors"
+	"github.com/harness/harness-docker-runner/internal/docker/jsonmessage"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDockerfile = "Dockerfile"
+
+// BuildResult describes the image built by a build step.
+type BuildResult struct {
+	ImageID string
+	Digests map[string]string // digest of each pushed tag
+}
+
+// Build builds the image with the Docker build API, streaming the
+// build output, and pushes the tags if requested. A failing build
+// or push is reported as a non-zero exit code in the returned state.
+func (e *Docker) Build(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step,
+	build *spec.BuildConfig, output io.Writer) (*runtime.State, *BuildResult, error) {
+	// the build context must be inside the workspace, and the
+	// dockerfile inside the build context.
+	dir, err := joinInside(step.WorkingDir, build.Context)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build context %s must be inside the workspace", build.Context)
+	}
+	dockerfile := build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+	if _, err := joinInside(dir, dockerfile); err != nil {
+		return nil, nil, fmt.Errorf("dockerfile %s must be inside the build context", dockerfile)
+	}
+
+	buildContext, err := tarContext(dir, dockerfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer buildContext.Close()
+
+	opts := types.ImageBuildOptions{
+		Tags:        build.Tags,
+		Dockerfile:  filepath.ToSlash(dockerfile),
+		BuildArgs:   toBuildArgs(build.BuildArgs),
+		Target:      build.Target,
+		Labels:      build.Labels,
+		CacheFrom:   build.CacheFrom,
+		NoCache:     build.NoCache,
+		PullParent:  build.Pull,
+		Remove:      true,
+		ForceRemove: true,
+		AuthConfigs: toAuthConfigs(buildAuths(pipelineConfig, step)),
+	}
+
+	logrus.WithField("step_id", step.ID).WithField("context", dir).Traceln("building the image")
+	resp, err := e.client.ImageBuild(ctx, buildContext, opts)
+	if err != nil {
+		return nil, nil, errors.TrimExtraInfo(err)
+	}
+	defer resp.Body.Close()
+
+	result := &BuildResult{Digests: map[string]string{}}
+	err = jsonmessage.CopyAux(resp.Body, output, func(aux json.RawMessage) {
+		var built struct {
+			ID string `json:"ID"`
+		}
+		if json.Unmarshal(aux, &built) == nil && built.ID != "" {
+			result.ImageID = built.ID
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		fmt.Fprintf(output, "image build failed: %s\n", err)
+		return &runtime.State{Exited: true, ExitCode: 1}, result, nil
+	}
+	if result.ImageID != "" {
+		fmt.Fprintf(output, "Successfully built %s\n", result.ImageID)
+	}
+
+	if !build.Push {
+		return &runtime.State{Exited: true}, result, nil
+	}
+	for _, tag := range build.Tags {
+		digest, err := e.push(ctx, pipelineConfig, step, tag, output)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			fmt.Fprintf(output, "image push of %s failed: %s\n", tag, err)
+			return &runtime.State{Exited: true, ExitCode: 1}, result, nil
+		}
+		result.Digests[tag] = digest
+	}
+	return &runtime.State{Exited: true}, result, nil
+}
+
+// helper function joins the relative path to the base directory,
+// returning an error if the path is absolute or escapes the base
+// directory.
+func joinInside(base, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s is an absolute path", path)
+	}
+	joined := filepath.Join(base, filepath.Clean(path))
+	rel, err := filepath.Rel(base, joined)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of %s", path, base)
+	}
+	return joined, nil
+}
+
+// helper function emulates the `docker push` command, returning
+// the digest of the pushed image.
+func (e *Docker) push(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step,
+	tag string, output io.Writer) (string, error) {
+	opts := types.ImagePushOptions{}
+	if auth := lookupAuth(buildAuths(pipelineConfig, step), tag); auth != nil {
+		opts.RegistryAuth = auths.Header(auth.Username, auth.Password)
+	}
+
+	fmt.Fprintf(output, "Pushing %s\n", tag)
+	rc, err := e.client.ImagePush(ctx, tag, opts)
+	if err != nil {
+		return "", errors.TrimExtraInfo(err)
+	}
+	defer rc.Close()
+
+	var digest string
+	err = jsonmessage.CopyAux(rc, output, func(aux json.RawMessage) {
+		var pushed struct {
+			Digest string `json:"Digest"`
+		}
+		if json.Unmarshal(aux, &pushed) == nil && pushed.Digest != "" {
+			digest = pushed.Digest
+		}
+	})
+	return digest, err
+}
+
+// helper function returns the registry credentials available to
+// the build, the step credentials take precedence over the stage
+// credentials.
+func buildAuths(pipelineConfig *spec.PipelineConfig, step *spec.Step) []*spec.Auth {
+	var list []*spec.Auth
+	if step.Auth != nil {
+		list = append(list, step.Auth)
+	}
+	return append(list, pipelineConfig.Auths...)
+}
+
+// helper function returns the credentials for the registry of
+// the image, or nil if there are none.
+func lookupAuth(list []*spec.Auth, name string) *spec.Auth {
+	for _, auth := range list {
+		if auth != nil && image.MatchHostname(name, auth.Address) {
+			return auth
+		}
+	}
+	return nil
+}
+
+// helper function converts the registry credentials to the
+// build auth configuration, keyed by registry address.
+func toAuthConfigs(list []*spec.Auth) map[string]types.AuthConfig {
+	configs := map[string]types.AuthConfig{}
+	for _, auth := range list {
+		if auth == nil || auth.Address == "" {
+			continue
+		}
+		if _, ok := configs[auth.Address]; ok {
+			continue
+		}
+		configs[auth.Address] = types.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.Address,
+		}
+	}
+	return configs
+}
+
+func toBuildArgs(args map[string]string) map[string]*string {
+	to := map[string]*string{}
+	for k := range args {
+		v := args[k]
+		to[k] = &v
+	}
+	return to
+}
+
+// tarContext returns the build context directory as a tar stream,
+// excluding the files matched by the .dockerignore file. As with
+// the docker cli the Dockerfile and .dockerignore are always sent.
+func tarContext(dir, dockerfile string) (io.ReadCloser, error) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("cannot read build context: %w", err)
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("build context %s is not a directory", dir)
+	}
+
+	var excludes []string
+	if f, err := os.Open(filepath.Join(dir, ".dockerignore")); err == nil {
+		excludes, err = dockerignore.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[string]bool{
+		filepath.Clean(dockerfile): true,
+		".dockerignore":            true,
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			if !keep[rel] {
+				excluded, merr := pm.Matches(rel)
+				if merr != nil {
+					return merr
+				}
+				// excluded directories are still walked when the
+				// patterns contain exceptions, eg !dir/file.
+				if excluded && fi.IsDir() && !pm.Exclusions() {
+					return filepath.SkipDir
+				}
+				if excluded {
+					return nil
+				}
+			}
+			return addToTar(tw, path, filepath.ToSlash(rel), fi)
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// helper function writes the file to the tar stream.
+func addToTar(tw *tar.Writer, path, name string, fi os.FileInfo) error {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/harness-docker-runner/engine/spec"
+)
+
+func TestTarContext(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":         "FROM alpine",
+		".dockerignore":      "Dockerfile\n**/*.log\nnode_modules\n",
+		"main.go":            "package main",
+		"debug.log":          "log",
+		"node_modules/a.js":  "a",
+		"pkg/lib/lib.go":     "package lib",
+		"pkg/lib/output.log": "log",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rc, err := tarContext(dir, "Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var got []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			got = append(got, hdr.Name)
+		}
+	}
+	sort.Strings(got)
+
+	want := []string{".dockerignore", "Dockerfile", "main.go", "pkg/lib/lib.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want context files %v, got %v", want, got)
+	}
+}
+
+func TestBuildContextInside(t *testing.T) {
+	workspace := t.TempDir()
+	for _, name := range []string{"Dockerfile", "..Dockerfile", "app/Dockerfile"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(workspace, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(workspace, name), []byte("FROM alpine"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		context    string
+		dockerfile string
+		err        bool
+	}{
+		{context: "."},
+		{context: "app"},
+		{context: "app/..", dockerfile: "app/Dockerfile"},
+		{context: ".", dockerfile: "..Dockerfile"},
+		{context: "/etc", err: true},
+		{context: filepath.Join(workspace, "app"), err: true},
+		{context: "..", err: true},
+		{context: "../escape", err: true},
+		{context: "app/../../escape", err: true},
+		{context: "app", dockerfile: "../Dockerfile", err: true},
+		{context: "app", dockerfile: "/Dockerfile", err: true},
+	}
+	for _, test := range tests {
+		c := &fakeBuildClient{}
+		e := newDocker(c, nil, Opts{})
+		step := &spec.Step{ID: "build", WorkingDir: workspace}
+		build := &spec.BuildConfig{Context: test.context, Dockerfile: test.dockerfile}
+		_, _, err := e.Build(context.Background(), &spec.PipelineConfig{}, step, build, io.Discard)
+		if (err != nil) != test.err {
+			t.Errorf("Unexpected error %v for context %q and dockerfile %q", err, test.context, test.dockerfile)
+		}
+		if test.err && c.built {
+			t.Errorf("Want context %q and dockerfile %q not built", test.context, test.dockerfile)
+		}
+	}
+}
+
+type fakeBuildClient struct {
+	client.APIClient
+	built bool
+}
+
+func (c *fakeBuildClient) ImageBuild(_ context.Context, buildContext io.Reader, _ types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	c.built = true
+	_, err := io.Copy(io.Discard, buildContext)
+	return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, err
+}
+
+func TestLookupAuth(t *testing.T) {
+	list := []*spec.Auth{
+		{Address: "https://index.docker.io/v1/", Username: "hub"},
+		{Address: "gcr.io", Username: "gcr"},
+	}
+	if auth := lookupAuth(list, "gcr.io/project/app:1.0"); auth == nil || auth.Username != "gcr" {
+		t.Errorf("Want gcr credentials, got %v", auth)
+	}
+	if auth := lookupAuth(list, "quay.io/org/app"); auth != nil {
+		t.Errorf("Want no credentials, got %v", auth)
+	}
+}
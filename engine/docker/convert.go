@@ -96,6 +96,9 @@ func toHostConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step) *contain
 			Memory:     step.MemLimit,
 			MemorySwap: step.MemSwapLimit,
 		}
+		if step.PidsLimit > 0 {
+			config.Resources.PidsLimit = &step.PidsLimit
+		}
 	}
 
 	if len(step.Volumes) != 0 {
@@ -297,7 +300,8 @@ func isUnlimited(res *spec.Step) bool {
 		res.CPUQuota == 0 &&
 		res.CPUShares == 0 &&
 		res.MemLimit == 0 &&
-		res.MemSwapLimit == 0
+		res.MemSwapLimit == 0 &&
+		res.PidsLimit == 0
 }
 
 // returns true if the volume is a bind mount.
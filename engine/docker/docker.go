@@ -10,24 +10,28 @@ package docker
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/harness/harness-docker-runner/engine/docker/image"
 	"github.com/harness/harness-docker-runner/engine/spec"
+	herrors "github.com/harness/harness-docker-runner/errors"
 	"github.com/harness/harness-docker-runner/internal/docker/errors"
 	"github.com/harness/harness-docker-runner/internal/docker/jsonmessage"
-	"github.com/harness/harness-docker-runner/internal/docker/stdcopy"
+	"github.com/harness/harness-docker-runner/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
-	"github.com/drone/runner-go/logger"
+	"github.com/docker/docker/errdefs"
 	"github.com/drone/runner-go/pipeline/runtime"
 	"github.com/drone/runner-go/registry/auths"
 )
@@ -37,6 +41,10 @@ const (
 	running  = "running"
 )
 
+// pullProgressInterval is the interval at which the image pull
+// progress is summarized in the step output.
+var pullProgressInterval = 5 * time.Second
+
 // Opts configures the Docker engine.
 type Opts struct {
 	HidePull bool
@@ -45,18 +53,26 @@ type Opts struct {
 // Docker implements a Docker pipeline engine.
 type Docker struct {
 	client     client.APIClient
+	watcher    *Watcher
 	hidePull   bool
 	mu         sync.Mutex
 	containers []Container
+	images     map[string]*ImageInfo // by step id
 }
 
 // New returns a new engine.
 func New(client client.APIClient, opts Opts) *Docker {
+	return newDocker(client, NewWatcher(client), opts)
+}
+
+func newDocker(client client.APIClient, watcher *Watcher, opts Opts) *Docker {
 	return &Docker{
 		client:     client,
+		watcher:    watcher,
 		hidePull:   opts.HidePull,
 		mu:         sync.Mutex{},
 		containers: make([]Container, 0),
+		images:     map[string]*ImageInfo{},
 	}
 }
 
@@ -71,7 +87,7 @@ func NewEnv(opts Opts) (*Docker, error) {
 	if err != nil {
 		return nil, err
 	}
-	return New(cli, opts), nil
+	return newDocker(cli, getSharedWatcher(cli), opts), nil
 }
 
 // Ping pings the Docker daemon.
@@ -241,33 +257,68 @@ func (e *Docker) Destroy(ctx context.Context, pipelineConfig *spec.PipelineConfi
 // Run runs the pipeline step.
 func (e *Docker) Run(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step,
 	output io.Writer) (*runtime.State, error) {
+	// the container is named after the step, so the container of
+	// a previous attempt of the step must be removed first.
+	e.removePrevious(ctx, step.ID)
+
 	// create the container
 	logrus.WithField("step_id", step.ID).Traceln("creating the container")
-	err := e.create(ctx, pipelineConfig, step, output)
+	cctx, span := tracing.Start(ctx, "docker.create", attribute.String("image", step.Image))
+	id, err := e.create(cctx, pipelineConfig, step, output)
+	tracing.End(span, err)
 	if err != nil {
-		return nil, errors.TrimExtraInfo(err)
+		return nil, trimError(err)
 	}
+	// watch the container before it is started so that no
+	// lifecycle events are missed.
+	watch := e.watcher.Watch(id)
+	defer watch.Close()
 	// start the container
 	logrus.WithField("step_id", step.ID).Traceln("starting the container")
-	err = e.start(ctx, step.ID)
+	sctx, span := tracing.Start(ctx, "docker.start")
+	err = e.start(sctx, step.ID)
+	tracing.End(span, err)
 	if err != nil {
-		return nil, errors.TrimExtraInfo(err)
+		return nil, trimError(herrors.Infra(err))
 	}
-	// tail the container
+	// the container can exit before the events subscription is
+	// attached, in which case its events are never received.
+	if err := watch.Sync(ctx); err != nil {
+		logrus.WithField("step_id", step.ID).WithError(err).Warnln("failed to inspect the container")
+	}
+	// tail the container. The span lasts until all the output is
+	// written.
 	logrus.WithField("step_id", step.ID).Traceln("tailing the container")
-	err = e.tail(ctx, step.ID, output)
+	tctx, tailSpan := tracing.Start(ctx, "docker.tail")
+	tailed, err := e.tail(tctx, step, output)
 	if err != nil {
-		return nil, errors.TrimExtraInfo(err)
+		tracing.End(tailSpan, err)
+		return nil, trimError(herrors.Infra(err))
 	}
 	// wait for the response
-	return e.waitRetry(ctx, step.ID)
+	wctx, span := tracing.Start(ctx, "docker.wait")
+	state, err := e.wait(wctx, watch)
+	if state != nil {
+		span.SetAttributes(attribute.Int("exit_code", state.ExitCode),
+			attribute.Bool("oom_killed", state.OOMKilled))
+	}
+	tracing.End(span, err)
+	// make sure all output is written before the step completes
+	drain(step.ID, tailed)
+	tailSpan.End()
+	if err == nil {
+		if reason := watch.Exit().Reason(); reason != "" {
+			fmt.Fprintf(output, "\n%s\n", reason)
+		}
+	}
+	return state, err
 }
 
 //
 // emulate docker commands
 //
 
-func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step, output io.Writer) error { // nolint:gocyclo
+func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step, output io.Writer) (string, error) { // nolint:gocyclo
 	// create pull options with encoded authorization credentials.
 	pullopts := types.ImagePullOptions{}
 	if step.Auth != nil {
@@ -277,65 +328,84 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 		)
 	}
 
+	e.setImageInfo(step.ID, &ImageInfo{Image: step.Image})
+
+	// a step can request the platform of its image. The host must be
+	// able to run the platform, and the container is created from the
+	// local image of the platform.
+	var platform *spec.Platform
+	if step.Platform != "" {
+		p, err := ParsePlatform(step.Platform)
+		if err != nil {
+			return "", err
+		}
+		if err := e.checkPlatform(ctx, p); err != nil {
+			return "", err
+		}
+		pullopts.Platform = formatPlatform(p)
+		platform = &p
+	}
+
 	// automatically pull the latest version of the image if requested
 	// by the process configuration, or if the image is :latest
+	var pulled bool
 	if step.Pull == spec.PullAlways ||
 		(step.Pull == spec.PullDefault && image.IsLatest(step.Image)) {
-		rc, pullerr := e.client.ImagePull(ctx, step.Image, pullopts)
-		if pullerr == nil {
-			if e.hidePull {
-				if _, err := io.Copy(io.Discard, rc); err != nil {
-					logrus.WithField("error", err).Warnln("failed to discard image pull logs")
-				}
-			} else {
-				if err := jsonmessage.Copy(rc, output); err != nil {
-					logrus.WithField("error", err).Warnln("failed to output image pull logs")
-				}
-			}
-			rc.Close()
+		if err := e.pull(ctx, step, pullopts, output); err != nil {
+			return "", err
 		}
-		if pullerr != nil {
-			return pullerr
+		pulled = true
+	}
+
+	config := toConfig(pipelineConfig, step)
+	if platform != nil {
+		id, err := e.platformImage(ctx, step, *platform, pullopts, pulled, output)
+		if err != nil {
+			return "", err
 		}
+		config.Image = id
 	}
 
-	_, err := e.client.ContainerCreate(ctx,
-		toConfig(pipelineConfig, step),
+	created, err := e.client.ContainerCreate(ctx,
+		config,
 		toHostConfig(pipelineConfig, step),
 		toNetConfig(pipelineConfig, step),
 		step.ID,
 	)
 
+	// the container could not be created by the daemon.
+	if err != nil && !client.IsErrNotFound(err) {
+		return "", daemonError(err)
+	}
+
 	// automatically pull and try to re-create the image if the
 	// failure is caused because the image does not exist.
 	if client.IsErrNotFound(err) && step.Pull != spec.PullNever {
-		rc, pullerr := e.client.ImagePull(ctx, step.Image, pullopts)
-		if pullerr != nil {
-			return pullerr
-		}
-
-		if e.hidePull {
-			if _, cerr := io.Copy(io.Discard, rc); cerr != nil {
-				logrus.WithField("error", cerr).Warnln("failed to discard image pull logs")
-			}
-		} else {
-			if cerr := jsonmessage.Copy(rc, output); cerr != nil {
-				logrus.WithField("error", cerr).Warnln("failed to copy image pull logs to output")
-			}
+		if pullerr := e.pull(ctx, step, pullopts, output); pullerr != nil {
+			return "", pullerr
 		}
-		rc.Close()
 
 		// once the image is successfully pulled we attempt to
 		// re-create the container.
-		_, err = e.client.ContainerCreate(ctx,
-			toConfig(pipelineConfig, step),
+		created, err = e.client.ContainerCreate(ctx,
+			config,
 			toHostConfig(pipelineConfig, step),
 			toNetConfig(pipelineConfig, step),
 			step.ID,
 		)
+		err = daemonError(err)
+	}
+	if err == nil {
+		// record the platform and digest the image resolved to.
+		if _, resolved, digest, ierr := e.resolveImage(ctx, config.Image); ierr == nil {
+			e.updateImageInfo(step.ID, func(info *ImageInfo) {
+				info.Platform = formatPlatform(resolved)
+				info.Digest = digest
+			})
+		}
 	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// attach the container to user-defined networks.
@@ -346,7 +416,7 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 				Aliases: []string{net},
 			})
 			if err != nil {
-				return nil
+				return created.ID, nil
 			}
 		}
 	}
@@ -358,81 +428,175 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 	})
 	e.mu.Unlock()
 
-	return nil
+	return created.ID, nil
 }
 
-// helper function emulates the `docker start` command.
-func (e *Docker) start(ctx context.Context, id string) error {
-	return e.client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+// helper function emulates the `docker pull` command, summarizing
+// the pull progress in the step output and recording the pull stats
+// of the step.
+func (e *Docker) pull(ctx context.Context, step *spec.Step, pullopts types.ImagePullOptions, output io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "docker.pull", attribute.String("image", step.Image))
+	defer func() { tracing.End(span, err) }()
+
+	rc, err := e.client.ImagePull(ctx, step.Image, pullopts)
+	if err != nil {
+		return herrors.Infra(err)
+	}
+	defer rc.Close()
+
+	if e.hidePull {
+		output = io.Discard
+	}
+	stats, err := jsonmessage.CopyPull(rc, output, step.Image, pullProgressInterval)
+	if err != nil {
+		logrus.WithField("error", err).Warnln("failed to output image pull logs")
+	}
+	span.SetAttributes(attribute.Int64("bytes", stats.Bytes),
+		attribute.Int("layers", stats.Layers))
+	e.setImageInfo(step.ID, &ImageInfo{
+		Image:        step.Image,
+		Pulled:       true,
+		PullDuration: stats.Duration,
+		PullBytes:    stats.Bytes,
+		PullLayers:   stats.Layers,
+	})
+	return nil
 }
 
-// helper function emulates the `docker wait` command, blocking
-// until the container stops and returning the exit code.
-func (e *Docker) waitRetry(ctx context.Context, id string) (*runtime.State, error) {
-	for {
-		// if the context is canceled, meaning the
-		// pipeline timed out or was killed by the
-		// end-user, we should exit with an error.
-		if err := ctx.Err(); err != nil {
-			return nil, err
+// helper function returns the id of the local image of the step for
+// the platform, pulling the image if the local image is missing or
+// is of another platform.
+func (e *Docker) platformImage(ctx context.Context, step *spec.Step, platform spec.Platform,
+	pullopts types.ImagePullOptions, pulled bool, output io.Writer) (string, error) {
+	_, got, _, err := e.resolveImage(ctx, step.Image)
+	if (err != nil || !matchPlatform(platform, got)) && !pulled && step.Pull != spec.PullNever {
+		if err := e.pull(ctx, step, pullopts, output); err != nil {
+			return "", err
 		}
-		state, err := e.wait(ctx, id)
-		if err != nil {
-			return nil, err
-		}
-		if state.Exited {
-			return state, err
-		}
-		logger.FromContext(ctx).
-			WithField("container", id).
-			Trace("docker wait exited unexpectedly")
 	}
+	id, got, _, err := e.resolveImage(ctx, step.Image)
+	if err != nil {
+		return "", err
+	}
+	if !matchPlatform(platform, got) {
+		return "", fmt.Errorf("image %s is not available for platform %s, the local image is %s",
+			step.Image, formatPlatform(platform), formatPlatform(got))
+	}
+	return id, nil
 }
 
-// helper function emulates the `docker wait` command, blocking
-// until the container stops and returning the exit code.
-func (e *Docker) wait(ctx context.Context, id string) (*runtime.State, error) {
-	wait, errc := e.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
-	select {
-	case <-wait:
-	case <-errc:
+// ImageInfo describes the image a step container was created from.
+type ImageInfo struct {
+	Image        string
+	Platform     string // platform of the image, eg linux/amd64
+	Digest       string // repository digest of the image
+	Pulled       bool   // whether the image was pulled for the step
+	PullDuration time.Duration
+	PullBytes    int64
+	PullLayers   int
+}
+
+// ImageInfo returns the image the container of the step was created
+// from, or nil if the step has no container.
+func (e *Docker) ImageInfo(id string) *ImageInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.images[id]
+}
+
+func (e *Docker) setImageInfo(id string, info *ImageInfo) {
+	e.mu.Lock()
+	e.images[id] = info
+	e.mu.Unlock()
+}
+
+func (e *Docker) updateImageInfo(id string, fn func(*ImageInfo)) {
+	e.mu.Lock()
+	if info, ok := e.images[id]; ok {
+		fn(info)
 	}
+	e.mu.Unlock()
+}
 
-	info, err := e.client.ContainerInspect(ctx, id)
-	if err != nil {
-		return nil, err
+// helper function removes the container created by a previous
+// attempt of the step, if any.
+func (e *Docker) removePrevious(ctx context.Context, id string) {
+	e.mu.Lock()
+	var found bool
+	containers := make([]Container, 0, len(e.containers))
+	for _, ctr := range e.containers {
+		if ctr.ID == id {
+			found = true
+			continue
+		}
+		containers = append(containers, ctr)
 	}
+	e.containers = containers
+	e.mu.Unlock()
 
-	return &runtime.State{
-		Exited:    !info.State.Running,
-		ExitCode:  info.State.ExitCode,
-		OOMKilled: info.State.OOMKilled,
-	}, nil
+	if !found {
+		return
+	}
+	removeOpts := types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	}
+	if err := e.client.ContainerRemove(ctx, id, removeOpts); err != nil {
+		logrus.WithField("container", id).WithField("error", err).Warnln("failed to remove container of previous attempt")
+	}
 }
 
-// helper function emulates the `docker logs -f` command, streaming
-// all container logs until the container stops.
-func (e *Docker) tail(ctx context.Context, id string, output io.Writer) error {
-	opts := types.ContainerLogsOptions{
-		Follow:     true,
-		ShowStdout: true,
-		ShowStderr: true,
-		Details:    false,
-		Timestamps: false,
+// helper function trims the extra info of the error, keeping it
+// marked as an infra error.
+func trimError(err error) error {
+	if herrors.IsInfra(err) {
+		return herrors.Infra(errors.TrimExtraInfo(err))
 	}
+	return errors.TrimExtraInfo(err)
+}
 
-	logs, err := e.client.ContainerLogs(ctx, id, opts)
-	if err != nil {
+// helper function marks the error as an infra error if the docker
+// daemon could not be reached or failed to handle the request. The
+// requests the daemon rejects, eg because the step configuration is
+// invalid or the container name is in use, fail the same way on every
+// attempt and are not marked.
+func daemonError(err error) error {
+	var nerr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case client.IsErrConnectionFailed(err),
+		errdefs.IsSystem(err),
+		errdefs.IsUnavailable(err),
+		errdefs.IsDeadline(err),
+		stderrors.As(err, &nerr):
+		return herrors.Infra(err)
+	default:
 		return err
 	}
+}
 
-	go func() {
-		if _, err := stdcopy.StdCopy(output, output, logs); err != nil {
-			logrus.WithField("error", err).Warnln("failed to copy logs while tailing")
-		}
-		logs.Close()
-	}()
-	return nil
+// helper function emulates the `docker start` command.
+func (e *Docker) start(ctx context.Context, id string) error {
+	return e.client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+// helper function emulates the `docker wait` command, blocking
+// until the container stops and returning the exit code.
+func (e *Docker) wait(ctx context.Context, watch *Watch) (*runtime.State, error) {
+	select {
+	case <-ctx.Done():
+		// the pipeline timed out or was killed by the
+		// end-user, we should exit with an error.
+		return nil, ctx.Err()
+	case <-watch.Done():
+	}
+	exit := watch.Exit()
+	return &runtime.State{
+		Exited:    true,
+		ExitCode:  exit.ExitCode,
+		OOMKilled: exit.OOMKilled,
+	}, nil
 }
 
 // softStop stops the container giving them a 30 seconds grace period. The signal sent by ContainerStop is SIGTERM.
@@ -441,27 +605,33 @@ func (e *Docker) tail(ctx context.Context, id string, output io.Writer) error {
 func (e *Docker) softStop(ctx context.Context, name string) {
 	logrus.WithField("container", name).Infoln("starting soft stop")
 
+	// the events are keyed by the id of the container.
+	info, err := e.client.ContainerInspect(ctx, name)
+	if err != nil {
+		logrus.WithField("container", name).WithField("error", err).Warnln("failed to inspect the container")
+		return
+	}
+	watch := e.watcher.Watch(info.ID)
+	defer watch.Close()
+
 	timeout := 30 * time.Second
 	if err := e.client.ContainerStop(ctx, name, &timeout); err != nil {
 		logrus.WithField("container", name).WithField("error", err).Warnln("failed to stop the container")
 	}
 
 	// Before removing the container we want to be sure that it's in a healthy state to be removed.
-	now := time.Now()
-	for {
-		if time.Since(now) > timeout {
-			break
-		}
-		time.Sleep(1 * time.Second)
-		containerStatus, err := e.client.ContainerInspect(ctx, name)
-		if err != nil {
-			logrus.WithField("container", name).WithField("error", err).Warnln("failed to retrieve container stats")
-			continue
-		}
-		if containerStatus.State.Status == removing || containerStatus.State.Status == running {
-			continue
-		}
+	containerStatus, err := e.client.ContainerInspect(ctx, name)
+	if err != nil {
+		logrus.WithField("container", name).WithField("error", err).Warnln("failed to retrieve container stats")
+		return
+	}
+	if containerStatus.State.Status != removing && containerStatus.State.Status != running {
 		// everything has stopped
-		break
+		return
+	}
+	select {
+	case <-watch.Done():
+	case <-time.After(timeout):
+		logrus.WithField("container", name).Warnln("timed out waiting for the container to stop")
 	}
 }
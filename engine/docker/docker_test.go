@@ -0,0 +1,56 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/harness/harness-docker-runner/engine/spec"
+	herrors "github.com/harness/harness-docker-runner/errors"
+)
+
+func TestCreateInfraError(t *testing.T) {
+	tests := []struct {
+		err   error
+		infra bool
+	}{
+		{err: errdefs.FromStatusCode(errors.New("invalid mount config"), http.StatusBadRequest)},
+		{err: errdefs.FromStatusCode(errors.New("name already in use"), http.StatusConflict)},
+		{err: errdefs.FromStatusCode(errors.New("daemon failed"), http.StatusInternalServerError), infra: true},
+		{err: errdefs.FromStatusCode(errors.New("daemon unavailable"), http.StatusServiceUnavailable), infra: true},
+		{err: client.ErrorConnectionFailed("unix:///var/run/docker.sock"), infra: true},
+	}
+	for _, test := range tests {
+		e := newDocker(&fakeCreateClient{err: test.err}, nil, Opts{})
+		step := &spec.Step{ID: "step", Image: "alpine:3", Pull: spec.PullNever}
+		_, err := e.create(context.Background(), &spec.PipelineConfig{}, step, io.Discard)
+		if err == nil {
+			t.Errorf("Want error %q returned", test.err)
+			continue
+		}
+		// only infra errors are retried by the retry policy of
+		// the step.
+		if got := herrors.IsInfra(err); got != test.infra {
+			t.Errorf("Want infra %v for error %q, got %v", test.infra, test.err, got)
+		}
+	}
+}
+
+type fakeCreateClient struct {
+	client.APIClient
+	err error
+}
+
+func (c *fakeCreateClient) ContainerCreate(context.Context, *container.Config, *container.HostConfig, *network.NetworkingConfig, string) (container.ContainerCreateCreatedBody, error) {
+	return container.ContainerCreateCreatedBody{}, c.err
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// watcherReconnectDelay is the time to wait before resubscribing
+	// to the docker events after the subscription failed. The delay
+	// doubles on every consecutive failure up to the max delay.
+	watcherReconnectDelay    = time.Second
+	watcherMaxReconnectDelay = time.Minute
+)
+
+const (
+	eventDie    = "die"
+	eventOOM    = "oom"
+	eventKill   = "kill"
+	eventHealth = "health_status"
+)
+
+// Watcher subscribes to the docker events and tracks the lifecycle
+// of the containers watched by the runner. A single watcher is
+// shared by all the stages of the runner.
+type Watcher struct {
+	client client.APIClient
+
+	start   sync.Once
+	mu      sync.Mutex
+	watches map[string]*Watch // by container id
+	last    int64             // time of the last event, used to resume the subscription
+}
+
+// NewWatcher returns a new watcher. The watcher subscribes to the
+// docker events once the first container is watched, so that the
+// runners that only run steps on the host never connect to docker.
+func NewWatcher(client client.APIClient) *Watcher {
+	return &Watcher{
+		client:  client,
+		watches: map[string]*Watch{},
+	}
+}
+
+var (
+	sharedWatcherOnce sync.Once
+	sharedWatcher     *Watcher
+)
+
+// helper function returns the watcher shared by the engines of
+// the runner.
+func getSharedWatcher(client client.APIClient) *Watcher {
+	sharedWatcherOnce.Do(func() {
+		sharedWatcher = NewWatcher(client)
+	})
+	return sharedWatcher
+}
+
+// Watch starts watching the container with the given id. It must be
+// called before the container is started, so that no events are
+// missed, and the container must be synced once started in case it
+// exited before the watch was registered.
+func (w *Watcher) Watch(id string) *Watch {
+	// the events are replayed since the subscription started, so
+	// that the events of the containers started while it is being
+	// attached are not missed.
+	w.start.Do(func() {
+		w.mu.Lock()
+		w.last = time.Now().UnixNano()
+		w.mu.Unlock()
+		msgs, errs := w.subscribe(context.Background())
+		go w.run(msgs, errs)
+	})
+	watch := &Watch{id: id, watcher: w, done: make(chan struct{})}
+	w.mu.Lock()
+	w.watches[id] = watch
+	w.mu.Unlock()
+	return watch
+}
+
+func (w *Watcher) subscribe(ctx context.Context) (<-chan events.Message, <-chan error) {
+	opts := types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", "container"),
+			filters.Arg("event", eventDie),
+			filters.Arg("event", eventOOM),
+			filters.Arg("event", eventKill),
+			filters.Arg("event", eventHealth),
+		),
+	}
+	w.mu.Lock()
+	// replay the events since the watcher was created, or missed
+	// while the subscription was down.
+	opts.Since = fmt.Sprintf("%d.%09d", w.last/int64(time.Second), w.last%int64(time.Second))
+	w.mu.Unlock()
+	return w.client.Events(ctx, opts)
+}
+
+// run dispatches the events to the watches, resubscribing whenever
+// the subscription fails.
+func (w *Watcher) run(msgs <-chan events.Message, errs <-chan error) {
+	delay := watcherReconnectDelay
+	for {
+		select {
+		case msg := <-msgs:
+			delay = watcherReconnectDelay
+			w.dispatch(msg)
+		case err := <-errs:
+			logrus.WithError(err).WithField("delay", delay).Warnln("docker events subscription failed, resubscribing")
+			time.Sleep(delay)
+			delay = nextReconnectDelay(delay)
+			msgs, errs = w.subscribe(context.Background())
+			w.resync()
+		}
+	}
+}
+
+// helper function returns the delay before the next attempt to
+// resubscribe, doubling the delay up to the max delay.
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > watcherMaxReconnectDelay {
+		delay = watcherMaxReconnectDelay
+	}
+	return delay
+}
+
+func (w *Watcher) dispatch(msg events.Message) {
+	w.mu.Lock()
+	if msg.TimeNano > w.last {
+		w.last = msg.TimeNano
+	}
+	watch := w.watches[msg.Actor.ID]
+	w.mu.Unlock()
+	if watch == nil {
+		return
+	}
+
+	action := msg.Action
+	switch {
+	case action == eventDie:
+		code, _ := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+		watch.exited(func(exit *ContainerExit) { exit.ExitCode = code })
+	case action == eventOOM:
+		watch.update(func(exit *ContainerExit) { exit.OOMKilled = true })
+	case action == eventKill:
+		watch.update(func(exit *ContainerExit) { exit.Signal = msg.Actor.Attributes["signal"] })
+	case strings.HasPrefix(action, eventHealth+":"):
+		status := strings.TrimSpace(strings.TrimPrefix(action, eventHealth+":"))
+		watch.update(func(exit *ContainerExit) { exit.Health = status })
+	}
+}
+
+// resync inspects the watched containers after the subscription
+// was restored, in case their events could not be replayed.
+func (w *Watcher) resync() {
+	w.mu.Lock()
+	watches := make([]*Watch, 0, len(w.watches))
+	for _, watch := range w.watches {
+		watches = append(watches, watch)
+	}
+	w.mu.Unlock()
+
+	for _, watch := range watches {
+		watch.Sync(context.Background()) // nolint:errcheck
+	}
+}
+
+// Watch tracks the lifecycle events of a container.
+type Watch struct {
+	id      string
+	watcher *Watcher
+
+	mu   sync.Mutex
+	exit ContainerExit
+	done chan struct{}
+	once sync.Once
+}
+
+// Done returns a channel that is closed when the container exits.
+func (w *Watch) Done() <-chan struct{} {
+	return w.done
+}
+
+// Exit returns the exit details of the container.
+func (w *Watch) Exit() ContainerExit {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.exit
+}
+
+// Sync inspects the container and marks the watch done if the
+// container already exited, for the containers that exited before
+// their events could be received.
+func (w *Watch) Sync(ctx context.Context) error {
+	info, err := w.watcher.client.ContainerInspect(ctx, w.id)
+	if err != nil {
+		return err
+	}
+	if info.State == nil {
+		return nil
+	}
+	if info.State.Status == "exited" || info.State.Status == "dead" {
+		w.exited(func(exit *ContainerExit) {
+			exit.ExitCode = info.State.ExitCode
+			exit.OOMKilled = exit.OOMKilled || info.State.OOMKilled
+		})
+	}
+	return nil
+}
+
+// Close stops watching the container.
+func (w *Watch) Close() {
+	w.watcher.mu.Lock()
+	if w.watcher.watches[w.id] == w {
+		delete(w.watcher.watches, w.id)
+	}
+	w.watcher.mu.Unlock()
+}
+
+func (w *Watch) update(fn func(*ContainerExit)) {
+	w.mu.Lock()
+	fn(&w.exit)
+	w.mu.Unlock()
+}
+
+func (w *Watch) exited(fn func(*ContainerExit)) {
+	w.once.Do(func() {
+		w.update(fn)
+		close(w.done)
+	})
+}
+
+// ContainerExit describes how a container exited.
+type ContainerExit struct {
+	ExitCode  int
+	OOMKilled bool
+	Signal    string // signal the container was killed with by the daemon
+	Health    string // last health status reported by the health check
+}
+
+// Reason returns a human readable reason the container failed,
+// or an empty string if the exit code is all there is to tell.
+func (x ContainerExit) Reason() string {
+	var reasons []string
+	switch {
+	case x.ExitCode == 0:
+		return ""
+	case x.OOMKilled:
+		reasons = append(reasons, "the container was killed because it ran out of memory")
+	case x.Signal != "":
+		reasons = append(reasons, fmt.Sprintf("the container was killed by the docker daemon with signal %s", x.Signal))
+	case x.ExitCode > 128: // nolint:gomnd
+		reasons = append(reasons, fmt.Sprintf("the container process was terminated by signal %d", x.ExitCode-128)) // nolint:gomnd
+	}
+	if x.Health == "unhealthy" {
+		reasons = append(reasons, "the container health check was failing")
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	reason := strings.Join(reasons, ", ")
+	return strings.ToUpper(reason[:1]) + reason[1:]
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+func TestWatcher(t *testing.T) {
+	fake := &fakeEventsClient{msgs: make(chan events.Message)}
+	w := NewWatcher(fake)
+	watch := w.Watch("3f2a")
+	defer watch.Close()
+
+	send := func(action string, attrs map[string]string) {
+		fake.msgs <- events.Message{Action: action, Actor: events.Actor{ID: "3f2a", Attributes: attrs}}
+	}
+	// events of containers that are not watched are ignored,
+	// even if the containers have the same name.
+	fake.msgs <- events.Message{Action: "die", Actor: events.Actor{ID: "9c1b", Attributes: map[string]string{"name": "step"}}}
+	send("health_status: unhealthy", map[string]string{})
+	send("kill", map[string]string{"signal": "9"})
+	send("die", map[string]string{"exitCode": "137"})
+
+	select {
+	case <-watch.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Want the watch to be done once the container dies")
+	}
+	exit := watch.Exit()
+	if exit.ExitCode != 137 || exit.Signal != "9" || exit.Health != "unhealthy" {
+		t.Errorf("Unexpected container exit %+v", exit)
+	}
+	if got, want := exit.Reason(), "The container was killed by the docker daemon with signal 9, the container health check was failing"; got != want {
+		t.Errorf("Want reason %q, got %q", want, got)
+	}
+}
+
+func TestWatcherSync(t *testing.T) {
+	fake := &fakeEventsClient{
+		msgs:  make(chan events.Message),
+		state: &types.ContainerState{Status: "exited", ExitCode: 2},
+	}
+	w := NewWatcher(fake)
+	if fake.since != "" {
+		t.Errorf("Want no subscription until a container is watched")
+	}
+	other := w.Watch("9c1b")
+	defer other.Close()
+	if fake.since == "" {
+		t.Errorf("Want the events replayed since the subscription started")
+	}
+
+	// the container dies before the watch is registered, so its
+	// die event is never dispatched to the watch.
+	fake.msgs <- events.Message{Action: "die", Actor: events.Actor{ID: "3f2a", Attributes: map[string]string{"exitCode": "2"}}}
+	// the next event is received once the die event is dispatched.
+	fake.msgs <- events.Message{Action: "die", Actor: events.Actor{ID: "9c1b"}}
+	watch := w.Watch("3f2a")
+	defer watch.Close()
+	select {
+	case <-watch.Done():
+		t.Fatal("Want the watch to be pending until the container is synced")
+	default:
+	}
+
+	if err := watch.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-watch.Done():
+	default:
+		t.Fatal("Want the watch to be done once the exited container is synced")
+	}
+	if got := watch.Exit().ExitCode; got != 2 {
+		t.Errorf("Want exit code 2, got %d", got)
+	}
+}
+
+func TestNextReconnectDelay(t *testing.T) {
+	delay := watcherReconnectDelay
+	for i := 0; i < 10; i++ {
+		delay = nextReconnectDelay(delay)
+	}
+	if delay != watcherMaxReconnectDelay {
+		t.Errorf("Want delay capped at %s, got %s", watcherMaxReconnectDelay, delay)
+	}
+	if got := nextReconnectDelay(time.Second); got != 2*time.Second {
+		t.Errorf("Want delay doubled, got %s", got)
+	}
+}
+
+func TestContainerExitReason(t *testing.T) {
+	tests := []struct {
+		exit ContainerExit
+		want string
+	}{
+		{exit: ContainerExit{}, want: ""},
+		{exit: ContainerExit{ExitCode: 1}, want: ""},
+		{exit: ContainerExit{ExitCode: 137, OOMKilled: true, Signal: "9"}, want: "The container was killed because it ran out of memory"},
+		{exit: ContainerExit{ExitCode: 143}, want: "The container process was terminated by signal 15"},
+	}
+	for _, test := range tests {
+		if got := test.exit.Reason(); got != test.want {
+			t.Errorf("Want reason %q for %+v, got %q", test.want, test.exit, got)
+		}
+	}
+}
+
+type fakeEventsClient struct {
+	client.APIClient
+	msgs  chan events.Message
+	since string
+	state *types.ContainerState
+}
+
+func (c *fakeEventsClient) Events(_ context.Context, opts types.EventsOptions) (<-chan events.Message, <-chan error) {
+	c.since = opts.Since
+	return c.msgs, make(chan error)
+}
+
+func (c *fakeEventsClient) ContainerInspect(_ context.Context, id string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: c.state}}, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/harness/harness-docker-runner/internal/docker/stdcopy"
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// tailReconnectDelay is the time to wait before reconnecting
+	// to a broken container log stream.
+	tailReconnectDelay = time.Second
+
+	// tailMaxReconnects is the number of consecutive times the
+	// runner reconnects to a container log stream that fails
+	// without delivering any output.
+	tailMaxReconnects = 10
+
+	// tailDrainTimeout is the maximum time to wait for the log
+	// stream to be drained after the container exits.
+	tailDrainTimeout = 30 * time.Second
+)
+
+// helper function emulates the `docker logs -f` command, streaming
+// all container logs until the container stops. If the log stream
+// breaks while the container is running, or before all its output
+// was received, the stream is reopened from the last received
+// message. The returned channel is closed once the logs are drained.
+func (e *Docker) tail(ctx context.Context, step *spec.Step, output io.Writer) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	opts := types.ContainerLogsOptions{
+		Follow:     true,
+		ShowStdout: !step.IgnoreStdout,
+		ShowStderr: !step.IgnoreStderr,
+		Details:    false,
+		Timestamps: true,
+	}
+	if !opts.ShowStdout && !opts.ShowStderr {
+		close(done)
+		return done, nil
+	}
+
+	logs, err := e.client.ContainerLogs(ctx, step.ID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// docker timestamps the streams in separate copiers, so the
+	// messages of one stream can be received before earlier messages
+	// of the other. Each stream has its own cursor.
+	stdoutCursor, stderrCursor := new(logCursor), new(logCursor)
+	stdout := newTimestampWriter(output, logstream.Stdout, stdoutCursor)
+	stderr := newTimestampWriter(output, logstream.Stderr, stderrCursor)
+	go func() {
+		defer close(done)
+		for failures := 0; ; {
+			n, err := stdcopy.StdCopy(stdout, stderr, logs)
+			logs.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			// the stream ends without error once the container
+			// stops and all its output has been sent.
+			if err == nil && !e.isRunning(ctx, step.ID) {
+				return
+			}
+			if err != nil {
+				logrus.WithError(err).WithField("step_id", step.ID).Warnln("container log stream broke, reconnecting")
+			}
+			if n > 0 {
+				failures = 0
+			}
+
+			for logs = nil; logs == nil; {
+				if failures++; failures > tailMaxReconnects {
+					logrus.WithField("step_id", step.ID).Errorln("giving up reconnecting to the container log stream")
+					fmt.Fprintln(output, "Lost connection to the container log stream, the remaining output of the step is not available")
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(tailReconnectDelay):
+				}
+				opts.Since = reconnect(stdoutCursor, stderrCursor)
+				if logs, err = e.client.ContainerLogs(ctx, step.ID, opts); err != nil {
+					if client.IsErrNotFound(err) {
+						return
+					}
+					logrus.WithError(err).WithField("step_id", step.ID).Warnln("cannot reconnect to the container log stream")
+				}
+			}
+		}
+	}()
+	return done, nil
+}
+
+// helper function returns true if the container is running. The
+// container is assumed to be running if it cannot be inspected.
+func (e *Docker) isRunning(ctx context.Context, id string) bool {
+	info, err := e.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return !client.IsErrNotFound(err)
+	}
+	return info.State.Running
+}
+
+// helper function waits for the container logs to be drained.
+func drain(id string, tailed <-chan struct{}) {
+	select {
+	case <-tailed:
+	case <-time.After(tailDrainTimeout):
+		logrus.WithField("step_id", id).Warnln("timed out waiting for the container logs to be drained")
+	}
+}
+
+// logCursor tracks the last message received from a stream of the
+// container log stream, so that the messages sent again after
+// reconnecting to the stream are skipped.
+type logCursor struct {
+	last   time.Time // timestamp of the last message
+	count  int       // number of messages received with the last timestamp
+	replay bool      // whether the stream is replayed after a reconnect
+	skip   int       // number of messages with the last timestamp to skip
+}
+
+// next returns true if the message with the timestamp was not
+// received before. Messages are only skipped while the stream is
+// replayed after a reconnect.
+func (c *logCursor) next(ts time.Time) bool {
+	if ts.IsZero() {
+		return true
+	}
+	if c.replay {
+		switch {
+		case ts.Before(c.last):
+			return false
+		case ts.Equal(c.last) && c.skip > 0:
+			c.skip--
+			return false
+		}
+		c.replay = false
+	}
+	switch {
+	case ts.Equal(c.last):
+		c.count++
+	case ts.After(c.last):
+		c.last, c.count = ts, 1
+	}
+	return true
+}
+
+// reconnect returns the since option to reopen the log stream
+// with, which is the last message of the stream that is the most
+// behind. The streams skip the messages they already received,
+// including the messages with their last timestamp, as since is
+// inclusive.
+func reconnect(cursors ...*logCursor) string {
+	var since time.Time
+	for _, c := range cursors {
+		if c.last.IsZero() {
+			continue
+		}
+		c.replay, c.skip = true, c.count
+		if since.IsZero() || c.last.Before(since) {
+			since = c.last
+		}
+	}
+	if since.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+}
+
+// timestampWriter strips the timestamp docker prefixes each log
+// message with, and writes the message to the stream of the step
+// output stamped with the time the container produced it.
+type timestampWriter struct {
+	w      io.Writer
+	stream string
+	cursor *logCursor
+}
+
+func newTimestampWriter(w io.Writer, stream string, cursor *logCursor) *timestampWriter {
+	return &timestampWriter{w: w, stream: stream, cursor: cursor}
+}
+
+// Write writes a single log message. The docker log stream
+// multiplexer writes each message with one call to Write.
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	ts, msg := parseTimestamp(p)
+	if !t.cursor.next(ts) {
+		return len(p), nil
+	}
+	if _, err := logstream.WriteStream(t.w, t.stream, ts, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// parseTimestamp splits the log message into the timestamp and the
+// message. The timestamp is zero if the message has no timestamp.
+func parseTimestamp(p []byte) (time.Time, []byte) {
+	i := bytes.IndexByte(p, ' ')
+	if i == -1 {
+		// empty messages are sent without the separating space.
+		i = len(p)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(p[:i]))
+	if err != nil {
+		return time.Time{}, p
+	}
+	if i < len(p) {
+		i++
+	}
+	return ts, p[i:]
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/harness/harness-docker-runner/internal/docker/stdcopy"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		ts   time.Time
+		want string
+	}{
+		{in: "2022-03-04T05:06:07.123456789Z hello world\n", ts: time.Date(2022, 3, 4, 5, 6, 7, 123456789, time.UTC), want: "hello world\n"},
+		{in: "2022-03-04T05:06:07Z", ts: time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC), want: ""},
+		{in: "hello world\n", want: "hello world\n"},
+		{in: "", want: ""},
+	}
+	for _, test := range tests {
+		ts, msg := parseTimestamp([]byte(test.in))
+		if !ts.Equal(test.ts) {
+			t.Errorf("Want timestamp %s for %q, got %s", test.ts, test.in, ts)
+		}
+		if string(msg) != test.want {
+			t.Errorf("Want message %q for %q, got %q", test.want, test.in, msg)
+		}
+	}
+}
+
+func TestTailReconnect(t *testing.T) {
+	defer func(d time.Duration) { tailReconnectDelay = d }(tailReconnectDelay)
+	tailReconnectDelay = time.Millisecond
+
+	ts := "2022-03-04T05:06:07.000000001Z "
+	fake := &fakeLogsClient{
+		streams: []io.Reader{
+			// the stream breaks after two messages with the same timestamp.
+			io.MultiReader(logFrames(ts+"one\n", ts+"two\n"), iotestErrReader{}),
+			// since is inclusive, so both messages are sent again.
+			logFrames(ts+"one\n", ts+"two\n", "2022-03-04T05:06:08Z three\n"),
+		},
+	}
+	e := &Docker{client: fake}
+
+	out := new(bytes.Buffer)
+	tailed, err := e.tail(context.Background(), &spec.Step{ID: "step"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tailed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Want logs to be drained")
+	}
+	if got, want := out.String(), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if got := fake.since; len(got) != 2 || got[1] != "1646370367.000000001" {
+		t.Errorf("Want the stream to be reopened since the last message, got %q", got)
+	}
+}
+
+func TestTailInterleavedStreams(t *testing.T) {
+	defer func(d time.Duration) { tailReconnectDelay = d }(tailReconnectDelay)
+	tailReconnectDelay = time.Millisecond
+
+	// the stdout and stderr messages are slightly out of order, and
+	// the stream breaks once.
+	first := new(bytes.Buffer)
+	stdout := stdcopy.NewStdWriter(first, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(first, stdcopy.Stderr)
+	stdout.Write([]byte("2022-03-04T05:06:07.2Z out1\n")) // nolint:errcheck
+	stderr.Write([]byte("2022-03-04T05:06:07.1Z err1\n")) // nolint:errcheck
+	stdout.Write([]byte("2022-03-04T05:06:07.4Z out2\n")) // nolint:errcheck
+	stderr.Write([]byte("2022-03-04T05:06:07.3Z err2\n")) // nolint:errcheck
+	second := new(bytes.Buffer)
+	stdout = stdcopy.NewStdWriter(second, stdcopy.Stdout)
+	stderr = stdcopy.NewStdWriter(second, stdcopy.Stderr)
+	// the messages since the last stderr message are sent again.
+	stderr.Write([]byte("2022-03-04T05:06:07.3Z err2\n")) // nolint:errcheck
+	stdout.Write([]byte("2022-03-04T05:06:07.4Z out2\n")) // nolint:errcheck
+	stdout.Write([]byte("2022-03-04T05:06:07.6Z out3\n")) // nolint:errcheck
+	stderr.Write([]byte("2022-03-04T05:06:07.5Z err3\n")) // nolint:errcheck
+
+	fake := &fakeLogsClient{streams: []io.Reader{io.MultiReader(first, iotestErrReader{}), second}}
+	e := &Docker{client: fake}
+
+	out := new(bytes.Buffer)
+	tailed, err := e.tail(context.Background(), &spec.Step{ID: "step"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tailed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Want logs to be drained")
+	}
+	if got, want := out.String(), "out1\nerr1\nout2\nerr2\nout3\nerr3\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if got := fake.since; len(got) != 2 || got[1] != "1646370367.300000000" {
+		t.Errorf("Want the stream to be reopened since the last stderr message, got %q", got)
+	}
+}
+
+type fakeLogsClient struct {
+	client.APIClient
+	streams []io.Reader
+	since   []string
+}
+
+func (c *fakeLogsClient) ContainerLogs(_ context.Context, _ string, opts types.ContainerLogsOptions) (io.ReadCloser, error) {
+	c.since = append(c.since, opts.Since)
+	if len(c.since) > len(c.streams) {
+		return nil, errors.New("no more streams")
+	}
+	return io.NopCloser(c.streams[len(c.since)-1]), nil
+}
+
+func (c *fakeLogsClient) ContainerInspect(context.Context, string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{}}}, nil
+}
+
+// helper function returns the messages as a multiplexed stdout stream.
+func logFrames(messages ...string) io.Reader {
+	buf := new(bytes.Buffer)
+	w := stdcopy.NewStdWriter(buf, stdcopy.Stdout)
+	for _, m := range messages {
+		w.Write([]byte(m)) // nolint:errcheck
+	}
+	return buf
+}
+
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
@@ -0,0 +1,140 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/harness/harness-docker-runner/engine/spec"
+)
+
+// binfmtDir is the directory in which the emulators used to run
+// binaries of foreign architectures are registered.
+var binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// ParsePlatform parses a platform in the os/arch[/variant] format,
+// eg linux/arm64 or linux/arm/v7.
+func ParsePlatform(s string) (spec.Platform, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" { // nolint:gomnd
+		return spec.Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+	}
+	p := spec.Platform{OS: parts[0], Arch: normalizeArch(parts[1])}
+	if len(parts) == 3 { // nolint:gomnd
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// helper function returns the platform in the os/arch[/variant]
+// format expected by the docker api.
+func formatPlatform(p spec.Platform) string {
+	s := p.OS + "/" + p.Arch
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// helper function converts the architecture reported by the kernel
+// to the architecture name used by images.
+func normalizeArch(arch string) string {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "armv7l", "armhf":
+		return "arm"
+	case "i386", "i686":
+		return "386"
+	}
+	return arch
+}
+
+// helper function returns the name of the qemu emulator for the
+// architecture.
+func qemuArch(arch string) string {
+	switch arch {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i386"
+	}
+	return arch
+}
+
+// checkPlatform returns an error if the docker host cannot run
+// containers of the platform, either natively or with an emulator.
+func (e *Docker) checkPlatform(ctx context.Context, p spec.Platform) error {
+	info, err := e.client.Info(ctx)
+	if err != nil {
+		return err
+	}
+	hostOS, hostArch := strings.ToLower(info.OSType), normalizeArch(info.Architecture)
+	host := hostOS + "/" + hostArch
+	if hostOS != "" && p.OS != hostOS {
+		return fmt.Errorf("step requests platform %s but the docker host runs %s containers", formatPlatform(p), host)
+	}
+	if hostArch == "" || p.Arch == hostArch || (hostArch == "arm64" && p.Arch == "arm") {
+		return nil
+	}
+	// foreign architectures need an emulator. The emulators are only
+	// listed if the daemon runs on the runner host, otherwise the
+	// image is pulled and verified anyway.
+	if !e.isLocalDaemon(info) {
+		return nil
+	}
+	if _, err := os.Stat(binfmtDir); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(binfmtDir, "qemu-"+qemuArch(p.Arch))); err != nil {
+		return fmt.Errorf("step requests platform %s but the docker host is %s and has no emulator registered for %s",
+			formatPlatform(p), host, p.Arch)
+	}
+	return nil
+}
+
+// helper function returns true if the docker daemon runs on the
+// runner host. A daemon reached over the network, or running in the
+// virtual machine of docker desktop, reports another host name.
+func (e *Docker) isLocalDaemon(info types.Info) bool {
+	host := e.client.DaemonHost()
+	if !strings.HasPrefix(host, "unix://") && !strings.HasPrefix(host, "npipe://") {
+		return false
+	}
+	hostname, err := os.Hostname()
+	return err == nil && info.Name == hostname
+}
+
+// resolveImage returns the id, platform and digest of the local
+// image of the step.
+func (e *Docker) resolveImage(ctx context.Context, name string) (id string, platform spec.Platform, digest string, err error) {
+	img, _, err := e.client.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return "", spec.Platform{}, "", err
+	}
+	if len(img.RepoDigests) > 0 {
+		digest = img.RepoDigests[0]
+		if i := strings.LastIndex(digest, "@"); i != -1 {
+			digest = digest[i+1:]
+		}
+	}
+	return img.ID, spec.Platform{OS: img.Os, Arch: normalizeArch(img.Architecture)}, digest, nil
+}
+
+// helper function returns true if the image platform matches the
+// requested platform. The variant is not compared as it is not
+// reported for local images.
+func matchPlatform(want, got spec.Platform) bool {
+	return want.OS == got.OS && want.Arch == got.Arch
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/harness-docker-runner/engine/spec"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		in   string
+		want spec.Platform
+		err  bool
+	}{
+		{in: "linux/arm64", want: spec.Platform{OS: "linux", Arch: "arm64"}},
+		{in: "linux/arm/v7", want: spec.Platform{OS: "linux", Arch: "arm", Variant: "v7"}},
+		{in: "Linux/x86_64", want: spec.Platform{OS: "linux", Arch: "amd64"}},
+		{in: "linux", err: true},
+		{in: "linux/arm/v7/extra", err: true},
+	}
+	for _, test := range tests {
+		got, err := ParsePlatform(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("Unexpected error %v for %q", err, test.in)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Want platform %+v for %q, got %+v", test.want, test.in, got)
+		}
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	defer func(dir string) { binfmtDir = dir }(binfmtDir)
+	binfmtDir = t.TempDir()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := types.Info{Name: hostname, OSType: "linux", Architecture: "x86_64"}
+	e := &Docker{client: &fakeInfoClient{info: info, host: "unix:///var/run/docker.sock"}}
+	ctx := context.Background()
+
+	if err := e.checkPlatform(ctx, spec.Platform{OS: "linux", Arch: "amd64"}); err != nil {
+		t.Errorf("Want native platform to be supported, got %s", err)
+	}
+	if err := e.checkPlatform(ctx, spec.Platform{OS: "windows", Arch: "amd64"}); err == nil {
+		t.Errorf("Want error for a platform of another os")
+	}
+	if err := e.checkPlatform(ctx, spec.Platform{OS: "linux", Arch: "arm64"}); err == nil {
+		t.Errorf("Want error for a foreign architecture without emulator")
+	}
+	if err := os.WriteFile(filepath.Join(binfmtDir, "qemu-aarch64"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.checkPlatform(ctx, spec.Platform{OS: "linux", Arch: "arm64"}); err != nil {
+		t.Errorf("Want foreign architecture with emulator to be supported, got %s", err)
+	}
+
+	// the emulators of a remote daemon, or of the virtual machine of
+	// docker desktop, cannot be listed.
+	remote := []*fakeInfoClient{
+		{info: info, host: "tcp://10.0.0.2:2376"},
+		{info: types.Info{Name: "docker-desktop", OSType: "linux", Architecture: "x86_64"}, host: "unix:///var/run/docker.sock"},
+	}
+	for _, c := range remote {
+		e := &Docker{client: c}
+		if err := e.checkPlatform(ctx, spec.Platform{OS: "linux", Arch: "s390x"}); err != nil {
+			t.Errorf("Want emulators of daemon %s %s not checked, got %s", c.info.Name, c.host, err)
+		}
+	}
+}
+
+type fakeInfoClient struct {
+	client.APIClient
+	info types.Info
+	host string
+}
+
+func (c *fakeInfoClient) DaemonHost() string {
+	return c.host
+}
+
+func (c *fakeInfoClient) Info(context.Context) (types.Info, error) {
+	return c.info, nil
+}
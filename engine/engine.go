@@ -29,20 +29,28 @@ const (
 	trueValue          = "true"
 )
 
+// Opts configures the engine.
+type Opts struct {
+	Docker docker.Opts
+	Exec   exec.Opts
+}
+
 type Engine struct {
 	pipelineConfig *spec.PipelineConfig
 	docker         *docker.Docker
+	execOpts       exec.Opts
 	mu             sync.Mutex
 }
 
-func NewEnv(opts docker.Opts) (*Engine, error) {
-	d, err := docker.NewEnv(opts)
+func NewEnv(opts Opts) (*Engine, error) {
+	d, err := docker.NewEnv(opts.Docker)
 	if err != nil {
 		return nil, err
 	}
 	return &Engine{
 		pipelineConfig: &spec.PipelineConfig{},
 		docker:         d,
+		execOpts:       opts.Exec,
 	}, nil
 }
 
@@ -96,13 +104,9 @@ func (e *Engine) Run(ctx context.Context, step *spec.Step, output io.Writer) (*r
 
 	envs := make(map[string]string)
 	if step.Image == "" {
-		// Set parent process envs in case step is executed directly on the VM.
+		// Set the allowed parent process envs in case step is executed directly on the VM.
 		// This sets the PATH environment variable (in case it is set on parent process) on sub-process executing the step.
-		for _, e := range os.Environ() {
-			if i := strings.Index(e, "="); i >= 0 {
-				envs[e[:i]] = e[i+1:]
-			}
-		}
+		envs = exec.Environ(e.execOpts.EnvAllowlist)
 	}
 	for k, v := range cfg.Envs {
 		envs[k] = v
@@ -126,7 +130,23 @@ func (e *Engine) Run(ctx context.Context, step *spec.Step, output io.Writer) (*r
 		return e.docker.Run(ctx, cfg, step, output)
 	}
 
-	return exec.Run(ctx, step, output)
+	return exec.Run(ctx, e.execOpts, step, output)
+}
+
+// Build builds the image of a build step with the Docker build API.
+func (e *Engine) Build(ctx context.Context, step *spec.Step, build *spec.BuildConfig, output io.Writer) (*runtime.State, *docker.BuildResult, error) {
+	e.mu.Lock()
+	cfg := e.pipelineConfig
+	e.mu.Unlock()
+
+	step.WorkingDir = pathConverter(step.WorkingDir)
+	return e.docker.Build(ctx, cfg, step, build, output)
+}
+
+// ImageInfo returns the image the container of the step was created
+// from, or nil if the step did not run in a container.
+func (e *Engine) ImageInfo(stepID string) *docker.ImageInfo {
+	return e.docker.ImageInfo(stepID)
 }
 
 func createFiles(paths []*spec.File) error {
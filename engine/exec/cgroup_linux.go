@@ -0,0 +1,183 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCPUPeriod = 100000
+	controllers      = "+cpu +cpuset +memory +pids"
+)
+
+// cgroup is a cgroup v2 created for a single host step.
+type cgroup struct {
+	path string
+}
+
+// newCgroup creates a cgroup for the step under root and applies
+// the step resource limits to it.
+func newCgroup(root string, step *spec.Step) (*cgroup, error) {
+	// the parent of the root must be a cgroup v2 directory.
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not available at %s: %w", filepath.Dir(root), err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil { // nolint:gomnd
+		return nil, err
+	}
+	// the controllers must be enabled in the parent of the
+	// step cgroup for the limits to be available.
+	enableControllers(filepath.Dir(root))
+	enableControllers(root)
+
+	c := &cgroup{path: filepath.Join(root, cgroupName(step.ID))}
+	if err := os.Mkdir(c.path, 0755); err != nil && !os.IsExist(err) { // nolint:gomnd
+		return nil, err
+	}
+	if err := c.setLimits(step); err != nil {
+		c.destroy()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *cgroup) setLimits(step *spec.Step) error {
+	if step.MemLimit > 0 {
+		if err := c.write("memory.max", strconv.FormatInt(step.MemLimit, 10)); err != nil {
+			return err
+		}
+		// as with docker, the swap limit is the combined limit
+		// of memory and swap.
+		if step.MemSwapLimit > step.MemLimit {
+			swap := strconv.FormatInt(step.MemSwapLimit-step.MemLimit, 10)
+			if err := c.write("memory.swap.max", swap); err != nil {
+				return err
+			}
+		}
+	}
+	if step.CPUQuota > 0 {
+		period := step.CPUPeriod
+		if period == 0 {
+			period = defaultCPUPeriod
+		}
+		if err := c.write("cpu.max", fmt.Sprintf("%d %d", step.CPUQuota, period)); err != nil {
+			return err
+		}
+	}
+	if step.CPUShares > 0 {
+		if err := c.write("cpu.weight", strconv.FormatInt(toCPUWeight(step.CPUShares), 10)); err != nil {
+			return err
+		}
+	}
+	if len(step.CPUSet) > 0 {
+		if err := c.write("cpuset.cpus", strings.Join(step.CPUSet, ",")); err != nil {
+			return err
+		}
+	}
+	if step.PidsLimit > 0 {
+		if err := c.write("pids.max", strconv.FormatInt(step.PidsLimit, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attach configures the command to be started in the cgroup, which
+// requires go 1.20 and linux 5.7. The returned function releases the cgroup
+// descriptor once the command is started.
+func (c *cgroup) attach(cmd *exec.Cmd) (func(), error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return func() { f.Close() }, nil
+}
+
+// oomKilled reports whether a process in the cgroup was killed
+// because it exceeded the memory limit.
+func (c *cgroup) oomKilled() bool {
+	f, err := os.Open(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" { // nolint:gomnd
+			n, _ := strconv.Atoi(fields[1])
+			return n > 0
+		}
+	}
+	return false
+}
+
+// destroy kills any process left in the cgroup and removes it.
+func (c *cgroup) destroy() {
+	// cgroup.kill is only available from linux 5.14, the process
+	// group has already been killed so this is best effort.
+	_ = c.write("cgroup.kill", "1")
+	if err := os.Remove(c.path); err != nil {
+		logrus.WithError(err).WithField("cgroup", c.path).Warnln("failed to remove step cgroup")
+	}
+}
+
+func (c *cgroup) write(file, value string) error {
+	return os.WriteFile(filepath.Join(c.path, file), []byte(value), 0644) // nolint:gomnd,gosec
+}
+
+// helper function returns the name of the step cgroup. The step id
+// is escaped so that it cannot name a path outside the root, and
+// prefixed so that it cannot clash with the cgroup interface files.
+func cgroupName(id string) string {
+	var b strings.Builder
+	b.WriteString("step-")
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// helper function enables the step controllers for the children
+// of the cgroup. Controllers which are not available are ignored.
+func enableControllers(path string) {
+	for _, ctrl := range strings.Fields(controllers) {
+		_ = os.WriteFile(filepath.Join(path, "cgroup.subtree_control"), []byte(ctrl), 0644) // nolint:gomnd,gosec
+	}
+}
+
+// helper function converts docker cpu shares [2-262144] to the
+// cgroup v2 cpu weight [1-10000].
+func toCPUWeight(shares int64) int64 {
+	if shares < 2 { // nolint:gomnd
+		shares = 2
+	}
+	if shares > 262144 { // nolint:gomnd
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142 // nolint:gomnd
+}
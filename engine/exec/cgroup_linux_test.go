@@ -0,0 +1,25 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package exec
+
+import "testing"
+
+func TestCgroupName(t *testing.T) {
+	tests := map[string]string{
+		"step1":        "step-step1",
+		"run_Step-2":   "step-run_Step-2",
+		"..":           "step-%2E%2E",
+		"../../escape": "step-%2E%2E%2F%2E%2E%2Fescape",
+		"cgroup.procs": "step-cgroup%2Eprocs",
+	}
+	for id, want := range tests {
+		if got := cgroupName(id); got != want {
+			t.Errorf("%s: want name %q, got %q", id, want, got)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package exec
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/harness/harness-docker-runner/engine/spec"
+)
+
+type cgroup struct{}
+
+func newCgroup(root string, step *spec.Step) (*cgroup, error) {
+	return nil, errors.New("resource limits for host steps are only supported on linux")
+}
+
+func (c *cgroup) attach(cmd *exec.Cmd) (func(), error) { return func() {}, nil }
+func (c *cgroup) oomKilled() bool                      { return false }
+func (c *cgroup) destroy()                             {}
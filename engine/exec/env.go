@@ -0,0 +1,55 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Environ returns the environment variables of the runner process
+// that are in the allowlist. An entry ending in * matches all the
+// variables with that prefix, and * on its own matches everything.
+// All the variables are returned if the allowlist is empty.
+func Environ(allowlist []string) map[string]string {
+	if len(allowlist) == 0 {
+		allowlist = []string{"*"}
+	}
+	envs := make(map[string]string)
+	for _, e := range os.Environ() {
+		i := strings.Index(e, "=")
+		// windows has per-drive variables such as =C:=C:\ which
+		// are never passed on.
+		if i <= 0 {
+			continue
+		}
+		if isAllowed(e[:i], allowlist) {
+			envs[e[:i]] = e[i+1:]
+		}
+	}
+	return envs
+}
+
+func isAllowed(name string, allowlist []string) bool {
+	// environment variable names are case insensitive on windows.
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if runtime.GOOS == "windows" {
+			entry = strings.ToUpper(entry)
+		}
+		if prefix := strings.TrimSuffix(entry, "*"); prefix != entry {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnviron(t *testing.T) {
+	os.Setenv("HDR_TEST_ALLOWED", "a")
+	os.Setenv("HDR_TEST_PREFIX_ONE", "b")
+	os.Setenv("HDR_TEST_SECRET", "c")
+	defer func() {
+		os.Unsetenv("HDR_TEST_ALLOWED")
+		os.Unsetenv("HDR_TEST_PREFIX_ONE")
+		os.Unsetenv("HDR_TEST_SECRET")
+	}()
+
+	envs := Environ([]string{"HDR_TEST_ALLOWED", "HDR_TEST_PREFIX_*"})
+	if got, want := envs["HDR_TEST_ALLOWED"], "a"; got != want {
+		t.Errorf("Want allowed env %q, got %q", want, got)
+	}
+	if got, want := envs["HDR_TEST_PREFIX_ONE"], "b"; got != want {
+		t.Errorf("Want prefixed env %q, got %q", want, got)
+	}
+	if _, ok := envs["HDR_TEST_SECRET"]; ok {
+		t.Errorf("Want env not in the allowlist to be scrubbed")
+	}
+
+	envs = Environ([]string{"*"})
+	if _, ok := envs["HDR_TEST_SECRET"]; !ok {
+		t.Errorf("Want all envs to be passed with a wildcard allowlist")
+	}
+}
+
+func TestEnvironEmptyAllowlist(t *testing.T) {
+	os.Setenv("HDR_TEST_INHERITED", "a")
+	defer os.Unsetenv("HDR_TEST_INHERITED")
+
+	if got, want := Environ(nil)["HDR_TEST_INHERITED"], "a"; got != want {
+		t.Errorf("Want all envs to be passed without allowlist, got %q", got)
+	}
+}
@@ -7,14 +7,59 @@ package exec
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"sync"
+	"time"
 
 	"github.com/drone/runner-go/pipeline/runtime"
 	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/sirupsen/logrus"
 )
 
-func Run(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State, error) {
+var (
+	// gracePeriod is the time a canceled step is given to exit
+	// after receiving SIGTERM before the process tree is killed.
+	gracePeriod = 10 * time.Second
+
+	// drainTimeout is the maximum time to wait for the output of
+	// processes that escaped the process group after the step exits.
+	drainTimeout = 5 * time.Second
+)
+
+// Opts configures the execution of steps on the host.
+type Opts struct {
+	// CgroupRoot is the cgroup v2 directory under which a cgroup
+	// is created for each step with resource limits.
+	CgroupRoot string
+
+	// EnvAllowlist lists the environment variables of the runner
+	// process that are passed to host steps. All the variables are
+	// passed if empty.
+	EnvAllowlist []string
+
+	// StrictUser fails the host steps that set a user on platforms
+	// that cannot run steps as another user, instead of running them
+	// as the runner user.
+	StrictUser bool
+
+	// StrictLimits fails the host steps with resource limits that
+	// cannot be applied, instead of running them without limits.
+	StrictLimits bool
+}
+
+// errUserUnsupported is returned by setUser on platforms that cannot
+// run steps as another user.
+var errUserUnsupported = errors.New("running host steps as a different user is not supported on this platform")
+
+// Run executes the step directly on the host. The step runs in its
+// own process group so that the whole process tree, including any
+// background processes, can be terminated once the step exits or
+// the context is canceled.
+func Run(ctx context.Context, opts Opts, step *spec.Step, output io.Writer) (state *runtime.State, err error) { // nolint:gocyclo
 	if len(step.Entrypoint) == 0 {
 		return nil, errors.New("step entrypoint cannot be empty")
 	}
@@ -25,24 +70,218 @@ func Run(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State
 	cmd := exec.Command(step.Entrypoint[0], cmdArgs...) //nolint:gosec
 	cmd.Dir = step.WorkingDir
 	cmd.Env = toEnv(step.Envs)
-	cmd.Stderr = output
-	cmd.Stdout = output
+	setProcessGroup(cmd)
+
+	if step.User != "" {
+		if err := setUser(cmd, step.User); err != nil {
+			if !errors.Is(err, errUserUnsupported) || opts.StrictUser {
+				return nil, err
+			}
+			// host steps historically ignored the user.
+			logrus.WithField("step_id", step.ID).Warnln("ignoring the user of host step")
+			fmt.Fprintf(output, "The step runs as the runner user: %s\n", err)
+		}
+	}
+
+	// resource limits are enforced with a cgroup the process is
+	// started in, so that the processes it forks cannot escape the
+	// limits. Unless strict, the step runs without limits if they
+	// cannot be applied.
+	if !isUnlimited(step) {
+		cg, release, err := limit(opts.CgroupRoot, step, cmd)
+		if err != nil {
+			if opts.StrictLimits {
+				return nil, fmt.Errorf("cannot apply resource limits to host step: %w", err)
+			}
+			logrus.WithError(err).WithField("step_id", step.ID).Warnln("ignoring the resource limits of host step")
+			fmt.Fprintf(output, "The step runs without resource limits: %s\n", err)
+		} else {
+			defer cg.destroy()
+			defer release()
+			defer func() {
+				if state != nil && cg.oomKilled() {
+					state.OOMKilled = true
+				}
+			}()
+		}
+	}
+
+	// the stdout and stderr of the process tree are written to pipes
+	// we own. Leaving this to os/exec would block Wait until every
+	// background process holding the pipes has exited. Ignored
+	// streams are connected to the null device.
+	var readers, writers []*os.File
+	var streams []string
+	if !step.IgnoreStdout {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = pw
+		readers, writers, streams = append(readers, pr), append(writers, pw), append(streams, logstream.Stdout)
+	}
+	if !step.IgnoreStderr {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			closeFiles(readers)
+			closeFiles(writers)
+			return nil, err
+		}
+		cmd.Stderr = pw
+		readers, writers, streams = append(readers, pr), append(writers, pw), append(streams, logstream.Stderr)
+	}
 
 	if err := cmd.Start(); err != nil {
+		closeFiles(readers)
+		closeFiles(writers)
 		return nil, err
 	}
+	closeFiles(writers)
+
+	var copying sync.WaitGroup
+	locked := &lockedWriter{w: output}
+	for i := range readers {
+		copying.Add(1)
+		go func(r io.Reader, stream string) {
+			defer copying.Done()
+			if _, err := io.Copy(logstream.NewStreamWriter(locked, stream), r); err != nil {
+				logrus.WithError(err).WithField("step_id", step.ID).Warnln("failed to copy step output")
+			}
+		}(readers[i], streams[i])
+	}
+	copied := make(chan struct{})
+	go func() {
+		copying.Wait()
+		close(copied)
+	}()
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+
+	var canceled bool
+	select {
+	case err = <-waited:
+		state, err = toState(cmd, err)
+		// the step has exited, make sure nothing it started in
+		// the background outlives it.
+		killProcessGroup(cmd)
+	case <-ctx.Done():
+		state = terminate(cmd, waited)
+		err = ctx.Err()
+		canceled = true
+	}
+
+	select {
+	case <-copied:
+	case <-time.After(drainTimeout):
+		logrus.WithField("step_id", step.ID).Warnln("timed out waiting for step output to be drained")
+	}
+	closeFiles(readers)
 
-	err := cmd.Wait()
+	if canceled {
+		fmt.Fprintf(output, "\n%s, process tree was terminated with exit code %d\n", reason(err), state.ExitCode)
+	}
+	return state, err
+}
+
+// terminate sends SIGTERM to the process group and waits for the
+// step to exit. If the step does not exit within the grace period
+// the process group is killed. It returns the state of the step,
+// with the exit code set to 128 plus the signal that ended it.
+func terminate(cmd *exec.Cmd, waited <-chan error) *runtime.State {
+	logrus.WithField("pid", cmd.Process.Pid).Infoln("sending terminate signal to step process group")
+	terminateProcessGroup(cmd)
+
+	select {
+	case <-waited:
+		killProcessGroup(cmd)
+		return &runtime.State{Exited: true, ExitCode: exitCodeTerminated}
+	case <-time.After(gracePeriod):
+	}
+
+	logrus.WithField("pid", cmd.Process.Pid).Infoln("grace period exceeded, killing step process group")
+	killProcessGroup(cmd)
+	<-waited
+	return &runtime.State{Exited: true, ExitCode: exitCodeKilled}
+}
+
+// lockedWriter serializes the writes of the stdout and stderr
+// streams to the step output.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func (l *lockedWriter) WriteStream(stream string, ts time.Time, p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return logstream.WriteStream(l.w, stream, ts, p)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// helper function converts the result of cmd.Wait to the
+// step state.
+func toState(cmd *exec.Cmd, err error) (*runtime.State, error) {
 	if err == nil {
 		return &runtime.State{ExitCode: 0, Exited: true}, nil
 	}
 
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		return &runtime.State{ExitCode: exitErr.ExitCode(), Exited: true}, nil
+	if _, ok := err.(*exec.ExitError); ok {
+		return &runtime.State{ExitCode: exitCode(cmd.ProcessState), Exited: true}, nil
 	}
 	return nil, err
 }
 
+// helper function returns a human readable termination reason
+// for the context error.
+func reason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "step timed out"
+	}
+	return "step was canceled"
+}
+
+// returns true if the step has no resource limits.
+// helper function creates the cgroup of the step under root and
+// configures the command to be started in it.
+func limit(root string, step *spec.Step, cmd *exec.Cmd) (*cgroup, func(), error) {
+	if root == "" {
+		return nil, nil, errors.New("no cgroup root is configured")
+	}
+	cg, err := newCgroup(root, step)
+	if err != nil {
+		return nil, nil, err
+	}
+	release, err := cg.attach(cmd)
+	if err != nil {
+		cg.destroy()
+		return nil, nil, err
+	}
+	return cg, release, nil
+}
+
+func isUnlimited(step *spec.Step) bool {
+	return len(step.CPUSet) == 0 &&
+		step.CPUQuota == 0 &&
+		step.CPUShares == 0 &&
+		step.MemLimit == 0 &&
+		step.MemSwapLimit == 0 &&
+		step.PidsLimit == 0
+}
+
 // helper function that converts a key value map of
 // environment variables to a string slice in key=value
 // format.
@@ -0,0 +1,114 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exitCodeTerminated = 128 + int(syscall.SIGTERM)
+	exitCodeKilled     = 128 + int(syscall.SIGKILL)
+)
+
+// setProcessGroup starts the command in a new session, which
+// makes it the leader of a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// setUser configures the command to run as the user. The user is
+// a name or uid, optionally followed by a group name or gid, in the
+// same format as the docker --user flag, eg 1000:1000.
+func setUser(cmd *exec.Cmd, u string) error {
+	parts := strings.SplitN(u, ":", 2) // nolint:gomnd
+	uid, gid, err := lookupUser(parts[0])
+	if err != nil {
+		return err
+	}
+	if len(parts) == 2 { // nolint:gomnd
+		if gid, err = lookupGroup(parts[1]); err != nil {
+			return err
+		}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid}
+	return nil
+}
+
+// helper function returns the uid and primary gid of the user. As
+// with docker, a uid without a passwd entry runs with gid 0.
+func lookupUser(name string) (uid, gid uint32, err error) {
+	var usr *user.User
+	if id, perr := strconv.ParseUint(name, 10, 32); perr == nil {
+		if usr, err = user.LookupId(name); err != nil {
+			return uint32(id), 0, nil
+		}
+	} else if usr, err = user.Lookup(name); err != nil {
+		return 0, 0, fmt.Errorf("cannot find user %s: %w", name, err)
+	}
+	if uid, err = parseID(usr.Uid); err != nil {
+		return 0, 0, err
+	}
+	if gid, err = parseID(usr.Gid); err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+// helper function returns the gid of the group.
+func lookupGroup(name string) (uint32, error) {
+	if id, err := parseID(name); err == nil {
+		return id, nil
+	}
+	grp, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("cannot find group %s: %w", name, err)
+	}
+	return parseID(grp.Gid)
+}
+
+func parseID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	return uint32(id), err
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) {
+	signalProcessGroup(cmd, syscall.SIGTERM)
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+// helper function sends the signal to every process in the
+// process group led by the command.
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	// a negative pid signals the process group.
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+		logrus.WithError(err).WithField("pid", cmd.Process.Pid).
+			WithField("signal", sig).Warnln("failed to signal step process group")
+	}
+}
+
+// helper function returns the exit code of the process, following
+// the shell convention of 128 plus the signal number if the process
+// was terminated by a signal.
+func exitCode(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness/harness-docker-runner/engine/spec"
+)
+
+func TestRunExitCode(t *testing.T) {
+	step := &spec.Step{
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"echo hello; exit 3"},
+	}
+	out := new(bytes.Buffer)
+	state, err := Run(context.Background(), Opts{}, step, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := state.ExitCode, 3; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := out.String(), "hello\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
+
+func TestRunIgnoreStream(t *testing.T) {
+	step := &spec.Step{
+		Entrypoint:   []string{"sh", "-c"},
+		Command:      []string{"echo out; echo err >&2"},
+		IgnoreStderr: true,
+	}
+	out := new(bytes.Buffer)
+	if _, err := Run(context.Background(), Opts{}, step, out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "out\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+
+	step.IgnoreStdout, step.IgnoreStderr = true, false
+	out.Reset()
+	if _, err := Run(context.Background(), Opts{}, step, out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "err\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
+
+func TestRunBackgroundProcess(t *testing.T) {
+	step := &spec.Step{
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"sleep 60 & echo done"},
+	}
+	st := time.Now()
+	state, err := Run(context.Background(), Opts{}, step, new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ExitCode != 0 {
+		t.Errorf("Want exit code 0, got %d", state.ExitCode)
+	}
+	if time.Since(st) > 10*time.Second {
+		t.Errorf("Want step to return once the main process exits")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	step := &spec.Step{
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"sleep 60 & sleep 60"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	out := new(bytes.Buffer)
+	state, err := Run(ctx, Opts{}, step, out)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want deadline exceeded error, got %v", err)
+	}
+	if got, want := state.ExitCode, exitCodeTerminated; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if !strings.Contains(out.String(), "step timed out") {
+		t.Errorf("Want termination reason in output, got %q", out.String())
+	}
+}
+
+func TestRunKillAfterGracePeriod(t *testing.T) {
+	defer func(d time.Duration) { gracePeriod = d }(gracePeriod)
+	gracePeriod = 100 * time.Millisecond
+
+	step := &spec.Step{
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"trap '' TERM; sleep 60 & wait"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	state, err := Run(ctx, Opts{}, step, new(bytes.Buffer))
+	if err != context.Canceled {
+		t.Errorf("Want canceled error, got %v", err)
+	}
+	if got, want := state.ExitCode, exitCodeKilled; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	tests := []struct {
+		user     string
+		uid, gid uint32
+	}{
+		{user: "0", uid: 0, gid: 0},
+		{user: "root", uid: 0, gid: 0},
+		{user: "root:1000", uid: 0, gid: 1000},
+		{user: "54321", uid: 54321, gid: 0},
+		{user: "54321:54321", uid: 54321, gid: 54321},
+	}
+	for _, test := range tests {
+		cmd := exec.Command("true")
+		setProcessGroup(cmd)
+		if err := setUser(cmd, test.user); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.user, err)
+			continue
+		}
+		if got := cmd.SysProcAttr.Credential; got.Uid != test.uid || got.Gid != test.gid {
+			t.Errorf("%s: want %d:%d, got %d:%d", test.user, test.uid, test.gid, got.Uid, got.Gid)
+		}
+	}
+
+	cmd := exec.Command("true")
+	setProcessGroup(cmd)
+	if err := setUser(cmd, "no-such-user-exists"); err == nil {
+		t.Errorf("Want error for unknown user")
+	}
+}
+
+func TestRunLimitsNotApplied(t *testing.T) {
+	step := &spec.Step{
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"echo hello"},
+		MemLimit:   64 << 20,
+	}
+	out := new(bytes.Buffer)
+	if _, err := Run(context.Background(), Opts{StrictLimits: true}, step, out); err == nil {
+		t.Errorf("Want error when the resource limits cannot be applied")
+	}
+	if out.Len() != 0 {
+		t.Errorf("Want step not executed, got output %q", out.String())
+	}
+
+	out.Reset()
+	state, err := Run(context.Background(), Opts{}, step, out)
+	if err != nil {
+		t.Errorf("Want step run without limits, got error %s", err)
+	} else if state.ExitCode != 0 {
+		t.Errorf("Want exit code 0, got %d", state.ExitCode)
+	}
+	if !strings.Contains(out.String(), "hello") {
+		t.Errorf("Want step output, got %q", out.String())
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exitCodeTerminated = 1
+	exitCodeKilled     = 1
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+func setUser(cmd *exec.Cmd, u string) error {
+	return errUserUnsupported
+}
+
+// terminateProcessGroup asks the process tree to close. Console
+// applications usually ignore this, in which case the tree is
+// killed once the grace period expires.
+func terminateProcessGroup(cmd *exec.Cmd) {
+	taskkill(cmd, "/T")
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	taskkill(cmd, "/T", "/F")
+}
+
+// helper function uses taskkill to end the process tree rooted
+// at the command. Windows has no process group signals, and the
+// tree can only be found while the root process is alive.
+func taskkill(cmd *exec.Cmd, args ...string) {
+	args = append(args, "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := exec.Command("taskkill", args...).Run(); err != nil { //nolint:gosec
+		logrus.WithError(err).WithField("pid", cmd.Process.Pid).
+			Traceln("taskkill did not end the step process tree")
+	}
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -20,6 +20,7 @@ type (
 		Envs              map[string]string `json:"envs,omitempty"`
 		Files             []*File           `json:"files,omitempty"`
 		EnableDockerSetup *bool             `json:"mount_docker_socket"`
+		Auths             []*Auth           `json:"auths,omitempty"`
 	}
 
 	// Step defines a pipeline step.
@@ -38,15 +39,17 @@ type (
 		Entrypoint   []string          `json:"entrypoint,omitempty"`
 		Envs         map[string]string `json:"environment,omitempty"`
 		ExtraHosts   []string          `json:"extra_hosts,omitempty"`
-		IgnoreStdout bool              `json:"ignore_stderr,omitempty"`
-		IgnoreStderr bool              `json:"ignore_stdout,omitempty"`
+		IgnoreStdout bool              `json:"ignore_stdout,omitempty"`
+		IgnoreStderr bool              `json:"ignore_stderr,omitempty"`
 		Image        string            `json:"image,omitempty"`
+		Platform     string            `json:"platform,omitempty"` // Target platform of the image, eg linux/arm64.
 		Labels       map[string]string `json:"labels,omitempty"`
 		MemSwapLimit int64             `json:"memswap_limit,omitempty"`
 		MemLimit     int64             `json:"mem_limit,omitempty"`
 		Name         string            `json:"name,omitempty"`
 		Network      string            `json:"network,omitempty"`
 		Networks     []string          `json:"networks,omitempty"`
+		PidsLimit    int64             `json:"pids_limit,omitempty"`
 		PortBindings map[string]string `json:"port_bindings,omitempty"` // Host port to container port mapping.
 		Privileged   bool              `json:"privileged,omitempty"`
 		Pull         PullPolicy        `json:"pull,omitempty"`
@@ -60,6 +63,21 @@ type (
 		Kind         string            `json:"kind,omitempty"`
 	}
 
+	// BuildConfig defines an image built by the runner with the
+	// Docker build API.
+	BuildConfig struct {
+		Context    string            `json:"context,omitempty"`    // build context directory, relative to the workspace
+		Dockerfile string            `json:"dockerfile,omitempty"` // Dockerfile path, relative to the build context
+		BuildArgs  map[string]string `json:"build_args,omitempty"`
+		Target     string            `json:"target,omitempty"`
+		Labels     map[string]string `json:"labels,omitempty"`
+		Tags       []string          `json:"tags,omitempty"` // fully qualified image names, eg registry/repo:tag
+		CacheFrom  []string          `json:"cache_from,omitempty"`
+		NoCache    bool              `json:"no_cache,omitempty"`
+		Pull       bool              `json:"pull,omitempty"` // always attempt to pull newer versions of the base images
+		Push       bool              `json:"push,omitempty"` // push the tags once the image is built
+	}
+
 	// Secret represents a secret variable.
 	Secret struct {
 		Name string `json:"name,omitempty"`
@@ -4,6 +4,8 @@
 
 package errors
 
+import "errors"
+
 type BadRequestError struct {
 	Msg string // description of error
 }
@@ -21,3 +23,28 @@ type InternalServerError struct {
 }
 
 func (e *InternalServerError) Error() string { return e.Msg }
+
+// InfraError is an error of the infrastructure a step runs on, eg
+// the image could not be pulled or the docker daemon failed, as
+// opposed to an error of the step itself. Only infra errors are
+// retried by the retry policy of a step.
+type InfraError struct {
+	Err error
+}
+
+func (e *InfraError) Error() string { return e.Err.Error() }
+func (e *InfraError) Unwrap() error { return e.Err }
+
+// Infra marks the error as an infra error.
+func Infra(err error) error {
+	if err == nil || IsInfra(err) {
+		return err
+	}
+	return &InfraError{Err: err}
+}
+
+// IsInfra reports whether the error is an infra error.
+func IsInfra(err error) bool {
+	var e *InfraError
+	return errors.As(err, &e)
+}
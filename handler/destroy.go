@@ -45,6 +45,10 @@ func HandleDestroy() http.HandlerFunc {
 
 		if d != nil {
 			logger.FromRequest(r).WithField("id", s.ID).Traceln("starting the destroy process")
+			// the host ports are released even if the destroy fails,
+			// the containers they were allocated for are gone or
+			// left to the system admin to clean up.
+			defer d.State.ReleasePorts()
 			if err := d.Engine.Destroy(r.Context()); err != nil {
 				WriteError(w, err)
 			} else {
@@ -13,6 +13,7 @@ import (
 	"github.com/harness/harness-docker-runner/engine"
 	"github.com/harness/harness-docker-runner/logger"
 	"github.com/harness/harness-docker-runner/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/tracing"
 )
 
 // Handler returns an http.Handler that exposes the service resources.
@@ -20,6 +21,7 @@ func Handler(config *config.Config, engine *engine.Engine, stepExecutor *runtime
 	r := chi.NewRouter()
 	r.Use(logger.Middleware)
 	r.Use(middleware.Recoverer)
+	r.Use(tracing.Middleware)
 
 	// Setup stage endpoint
 	r.Mount("/setup", func() http.Handler {
@@ -49,6 +51,13 @@ func Handler(config *config.Config, engine *engine.Engine, stepExecutor *runtime
 		return sr
 	}())
 
+	// Logs stored on the runner
+	r.Mount("/logs", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Get("/*", HandleLogs())
+		return sr
+	}())
+
 	// Health check
 	r.Mount("/healthz", func() http.Handler {
 		sr := chi.NewRouter()
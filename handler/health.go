@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/pipeline"
 	"github.com/harness/harness-docker-runner/setup"
 	"github.com/harness/harness-docker-runner/version"
 	"github.com/sirupsen/logrus"
@@ -27,6 +28,12 @@ func HandleHealth() http.HandlerFunc {
 			LiteEngineLog:   setup.GetLiteEngineLog(instanceInfo),
 			OK:              dockerOK && gitOK,
 		}
+		if stats := pipeline.LogSpoolStats(); stats != nil {
+			response.LogSpool = &api.LogSpoolStats{
+				Uploads: stats.Uploads,
+				Bytes:   stats.Bytes,
+			}
+		}
 		WriteJSON(w, response, http.StatusOK)
 	}
 }
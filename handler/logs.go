@@ -0,0 +1,105 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/harness/harness-docker-runner/errors"
+	"github.com/harness/harness-docker-runner/logger"
+	"github.com/harness/harness-docker-runner/logstream/filestore"
+	"github.com/harness/harness-docker-runner/logstream/remote"
+	"github.com/harness/harness-docker-runner/pipeline"
+)
+
+// HandleLogs returns an http.HandlerFunc that reads the logs of a
+// key stored on the runner. The offset and limit query parameters
+// select the lines, and format=raw returns the log output as plain
+// text instead of json.
+func HandleLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, "*")
+		if key == "" {
+			WriteBadRequest(w, &errors.BadRequestError{Msg: "log key needs to be set"})
+			return
+		}
+		query := r.URL.Query()
+		offset, err := queryInt(query.Get("offset"))
+		if err != nil {
+			WriteBadRequest(w, err)
+			return
+		}
+		limit, err := queryInt(query.Get("limit"))
+		if err != nil {
+			WriteBadRequest(w, err)
+			return
+		}
+
+		if query.Get("format") == "raw" {
+			// the output is written as it is read, so errors
+			// can only be logged once the output started.
+			started := false
+			_, err = filestore.Read(pipeline.LogStorePath, key, offset, limit, func(line *remote.Line) error {
+				if !started {
+					started = true
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					w.WriteHeader(http.StatusOK)
+				}
+				_, werr := io.WriteString(w, line.Message)
+				return werr
+			})
+			if err != nil && started {
+				logger.FromRequest(r).WithError(err).WithField("key", key).Errorln("api: failed to read logs")
+				return
+			}
+			if err != nil {
+				writeLogsError(w, key, err)
+				return
+			}
+			if !started {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		lines := []*remote.Line{}
+		logs, err := filestore.Read(pipeline.LogStorePath, key, offset, limit, func(line *remote.Line) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			writeLogsError(w, key, err)
+			return
+		}
+		logs.Lines = lines
+		WriteJSON(w, logs, http.StatusOK)
+	}
+}
+
+func writeLogsError(w http.ResponseWriter, key string, err error) {
+	if os.IsNotExist(err) {
+		WriteError(w, &errors.NotFoundError{Msg: fmt.Sprintf("no logs found for key %s", key)})
+		return
+	}
+	WriteError(w, err)
+}
+
+// helper function parses a non-negative integer query parameter.
+func queryInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, &errors.BadRequestError{Msg: fmt.Sprintf("invalid value %q, expected a non-negative integer", s)}
+	}
+	return v, nil
+}
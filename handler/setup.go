@@ -18,6 +18,7 @@ import (
 	"github.com/harness/harness-docker-runner/config"
 	"github.com/harness/harness-docker-runner/engine"
 	"github.com/harness/harness-docker-runner/engine/docker"
+	"github.com/harness/harness-docker-runner/engine/exec"
 	"github.com/harness/harness-docker-runner/engine/spec"
 	"github.com/harness/harness-docker-runner/executor"
 	"github.com/harness/harness-docker-runner/livelog"
@@ -25,9 +26,11 @@ import (
 	"github.com/harness/harness-docker-runner/pipeline"
 	prruntime "github.com/harness/harness-docker-runner/pipeline/runtime"
 	"github.com/harness/harness-docker-runner/ti"
+	"github.com/harness/harness-docker-runner/tracing"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // random generator function
@@ -49,6 +52,11 @@ func HandleSetup(config *config.Config) http.HandlerFunc {
 		}
 		id := s.ID
 
+		ctx, span := tracing.Start(tracing.WithCorrelationID(r.Context(), s.CorrelationID), "HandleSetup",
+			attribute.String("stage_id", id),
+			attribute.String("correlation_id", s.CorrelationID))
+		defer func() { tracing.End(span, err) }()
+
 		updateVolumes(s)
 
 		// Add ti volume where all the TI related data (CG, Agent logs, config) will be stored
@@ -58,7 +66,7 @@ func HandleSetup(config *config.Config) http.HandlerFunc {
 		tiConfig := getTiCfg(s.TIConfig, tiVolume.HostPath.Path)
 
 		setProxyEnvs(s.Envs)
-		engine, err := engine.NewEnv(docker.Opts{})
+		engine, err := engine.NewEnv(getEngineOpts(config))
 		if err != nil {
 			logger.FromRequest(r).WithError(err).Errorln("could not instantiate engine for the execution")
 			WriteError(w, err)
@@ -109,6 +117,7 @@ func HandleSetup(config *config.Config) http.HandlerFunc {
 			Volumes:           s.Volumes,
 			Files:             s.Files,
 			EnableDockerSetup: s.MountDockerSocket,
+			Auths:             s.Auths,
 		}
 
 		// Add the state of this execution to the executor
@@ -119,13 +128,13 @@ func HandleSetup(config *config.Config) http.HandlerFunc {
 		}
 
 		ex := executor.GetExecutor()
-		if err := ex.Add(id, stageData); err != nil {
+		if err = ex.Add(id, stageData); err != nil {
 			logger.FromRequest(r).WithError(err).Errorln("could not store stage data")
 			WriteError(w, err)
 			return
 		}
 
-		if err := engine.Setup(r.Context(), cfg); err != nil {
+		if err = engine.Setup(ctx, cfg); err != nil {
 			logger.FromRequest(r).WithError(err).
 				WithField("latency", time.Since(st)).
 				WithField("time", time.Now().Format(time.RFC3339)).
@@ -238,6 +247,18 @@ func setProxyEnvs(environment map[string]string) {
 	}
 }
 
+func getEngineOpts(config *config.Config) engine.Opts {
+	return engine.Opts{
+		Docker: docker.Opts{},
+		Exec: exec.Opts{
+			CgroupRoot:   config.Runner.HostCgroupRoot,
+			EnvAllowlist: config.Runner.HostEnvAllowlist,
+			StrictUser:   config.Runner.HostStrictUser,
+			StrictLimits: config.Runner.HostStrictLimits,
+		},
+	}
+}
+
 func getTiCfg(t api.TIConfig, dataDir string) tiCfg.Cfg {
 	cfg := tiCfg.New(t.URL, t.Token, t.AccountID, t.OrgID, t.ProjectID, t.PipelineID, t.BuildID, t.StageID, t.Repo,
 		t.Sha, t.CommitLink, t.SourceBranch, t.TargetBranch, t.CommitBranch, dataDir, t.ParseSavings, false, "", "")
@@ -24,6 +24,9 @@ import (
 	"github.com/harness/harness-docker-runner/engine/spec"
 	"github.com/harness/harness-docker-runner/logger"
 	pruntime "github.com/harness/harness-docker-runner/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // HandleExecuteStep returns an http.HandlerFunc that executes a step
@@ -38,6 +41,12 @@ func HandleStartStep(config *config.Config) http.HandlerFunc {
 			return
 		}
 
+		ctx, span := tracing.Start(tracing.WithCorrelationID(r.Context(), s.CorrelationID), "HandleStartStep",
+			attribute.String("stage_id", s.StageRuntimeID),
+			attribute.String("step_id", s.ID),
+			attribute.String("kind", s.Kind.String()))
+		defer func() { tracing.End(span, err) }()
+
 		if s.MountDockerSocket == nil || *s.MountDockerSocket { // required to support m1 where docker isn't installed.
 			s.Volumes = append(s.Volumes, getDockerSockVolumeMount())
 		}
@@ -51,8 +60,32 @@ func HandleStartStep(config *config.Config) http.HandlerFunc {
 		s.Volumes = append(s.Volumes, getSharedVolumeMount())
 		s.Volumes = append(s.Volumes, getGlobalVolumesMount(config)...)
 
+		// mask the values of the secrets referenced by plugin settings.
+		for _, secret := range s.Plugin.Secrets {
+			if secret != nil && secret.Mask {
+				s.Secrets = append(s.Secrets, string(secret.Data))
+			}
+		}
 		stageData.State.AppendSecrets(s.Secrets)
 
+		// allocate the dynamic host ports of the step and expose the
+		// ports allocated so far in the stage to the step.
+		if s.PortBindings, err = stageData.State.AllocatePorts(s.ID, s.PortBindings); err != nil {
+			logger.FromRequest(r).WithError(err).Errorln("cannot allocate host ports")
+			WriteError(w, err)
+			return
+		}
+		if envs := stageData.State.GetPortEnvs(); len(envs) > 0 {
+			if s.Envs == nil {
+				s.Envs = map[string]string{}
+			}
+			for k, v := range envs {
+				if _, ok := s.Envs[k]; !ok {
+					s.Envs[k] = v
+				}
+			}
+		}
+
 		s.StartStepRequestConfig.Network = stageData.State.GetNetwork()
 		hv, err := getHarnessVolume(stageData.State.GetVolumes())
 		if err != nil {
@@ -74,10 +107,9 @@ func HandleStartStep(config *config.Config) http.HandlerFunc {
 
 		// fmt.Printf("start step request config: %+v\n", s.StartStepRequestConfig)
 
-		ctx := r.Context()
 		logger.FromRequest(r).WithField("stage_id", s.StageRuntimeID).
 			WithField("step_id", s.ID).Traceln("starting step execution")
-		if err := stageData.StepExecutor.StartStep(ctx, &s, stageData.State.GetSecrets(), stageData.State.GetLogStreamClient(), stageData.State.GetTIConfig(), stageData.State.GetLogConfig()); err != nil {
+		if err = stageData.StepExecutor.StartStep(ctx, &s, stageData.State.GetSecrets(), stageData.State.GetLogStreamClient(), stageData.State.GetTIConfig(), stageData.State.GetLogConfig()); err != nil {
 			WriteError(w, err)
 		}
 
@@ -24,17 +24,28 @@ func (e *jsonError) Error() string {
 }
 
 type jsonMessage struct {
-	ID       string        `json:"id"`
-	Status   string        `json:"status"`
-	Error    *jsonError    `json:"errorDetail"`
-	Progress *jsonProgress `json:"progressDetail"`
+	ID       string           `json:"id"`
+	Status   string           `json:"status"`
+	Stream   string           `json:"stream"`
+	Error    *jsonError       `json:"errorDetail"`
+	Progress *jsonProgress    `json:"progressDetail"`
+	Aux      *json.RawMessage `json:"aux"`
 }
 
 type jsonProgress struct {
+	Current int64 `json:"current"`
+	Total   int64 `json:"total"`
 }
 
 // Copy copies a json message string to the io.Writer.
 func Copy(in io.Reader, out io.Writer) error {
+	return CopyAux(in, out, nil)
+}
+
+// CopyAux copies a json message string to the io.Writer. The
+// auxiliary data of the messages, such as the id of a built image
+// or the digest of a pushed image, is passed to the aux function.
+func CopyAux(in io.Reader, out io.Writer, aux func(json.RawMessage)) error {
 	dec := json.NewDecoder(in)
 	for {
 		var jm jsonMessage
@@ -53,6 +64,18 @@ func Copy(in io.Reader, out io.Writer) error {
 			return jm.Error
 		}
 
+		if jm.Aux != nil {
+			if aux != nil {
+				aux(*jm.Aux)
+			}
+			continue
+		}
+		// build output is streamed as is, it already includes
+		// the line feeds.
+		if jm.Stream != "" {
+			fmt.Fprint(out, jm.Stream)
+			continue
+		}
 		if jm.Progress != nil {
 			continue
 		}
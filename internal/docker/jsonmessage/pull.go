@@ -0,0 +1,141 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package jsonmessage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// layer statuses reported by the image pull.
+const (
+	statusDownloading      = "Downloading"
+	statusDownloadComplete = "Download complete"
+	statusPullComplete     = "Pull complete"
+	statusAlreadyExists    = "Already exists"
+	statusPullingFrom      = "Pulling from"
+)
+
+// PullStats summarizes an image pull.
+type PullStats struct {
+	Layers     int           // number of layers of the image
+	LayersDone int           // number of layers pulled or already present
+	Bytes      int64         // number of bytes downloaded
+	Duration   time.Duration // time taken by the pull
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// CopyPull copies the output of an image pull to the io.Writer.
+// Instead of a line for each layer status, a summary of the pull
+// progress is written at most once per interval, followed by a
+// final summary once the pull completes.
+func CopyPull(in io.Reader, out io.Writer, image string, interval time.Duration) (*PullStats, error) {
+	start := time.Now()
+	last := start
+	layers := map[string]*layerProgress{}
+	var order []string
+
+	stats := func() *PullStats {
+		s := &PullStats{Layers: len(order), Duration: time.Since(start)}
+		for _, id := range order {
+			l := layers[id]
+			s.Bytes += l.current
+			if l.done {
+				s.LayersDone++
+			}
+		}
+		return s
+	}
+
+	dec := json.NewDecoder(in)
+	for {
+		var jm jsonMessage
+		if err := dec.Decode(&jm); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return stats(), err
+		}
+		if jm.Error != nil {
+			if jm.Error.Code == 401 { // nolint:gomnd
+				return stats(), fmt.Errorf("authentication is required")
+			}
+			fmt.Fprintf(out, "%s\n", jm.Error)
+			return stats(), jm.Error
+		}
+
+		// messages that are not about a layer, such as the digest
+		// and the final status, are written as is.
+		if jm.ID == "" || strings.HasPrefix(jm.Status, statusPullingFrom) {
+			if jm.ID == "" {
+				fmt.Fprintf(out, "%s\n", jm.Status)
+			} else {
+				fmt.Fprintf(out, "%s: %s\n", jm.ID, jm.Status)
+			}
+			continue
+		}
+
+		l, ok := layers[jm.ID]
+		if !ok {
+			l = new(layerProgress)
+			layers[jm.ID] = l
+			order = append(order, jm.ID)
+		}
+		switch jm.Status {
+		case statusDownloading:
+			if jm.Progress != nil {
+				l.current, l.total = jm.Progress.Current, jm.Progress.Total
+			}
+		case statusDownloadComplete:
+			if l.total > 0 {
+				l.current = l.total
+			}
+		case statusPullComplete, statusAlreadyExists:
+			if l.total > 0 {
+				l.current = l.total
+			}
+			l.done = true
+		}
+
+		if time.Since(last) >= interval {
+			last = time.Now()
+			writeProgress(out, image, stats(), layers)
+		}
+	}
+
+	s := stats()
+	if s.Layers > 0 {
+		fmt.Fprintf(out, "Pulled %s: %d layers, %s downloaded in %s (%s/s)\n", image, s.Layers,
+			units.HumanSize(float64(s.Bytes)), s.Duration.Round(time.Millisecond), units.HumanSize(rate(s)))
+	}
+	return s, nil
+}
+
+func writeProgress(out io.Writer, image string, s *PullStats, layers map[string]*layerProgress) {
+	var total int64
+	for _, l := range layers {
+		total += l.total
+	}
+	fmt.Fprintf(out, "Pulling %s: %d/%d layers, %s of %s downloaded (%s/s)\n", image, s.LayersDone, s.Layers,
+		units.HumanSize(float64(s.Bytes)), units.HumanSize(float64(total)), units.HumanSize(rate(s)))
+}
+
+// helper function returns the download rate in bytes per second.
+func rate(s *PullStats) float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
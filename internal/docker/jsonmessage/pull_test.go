@@ -0,0 +1,44 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package jsonmessage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCopyPull(t *testing.T) {
+	in := strings.NewReader(`
+{"status":"Pulling from library/alpine","id":"3"}
+{"status":"Already exists","progressDetail":{},"id":"a"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"b"}
+{"status":"Downloading","progressDetail":{"current":512,"total":2048},"id":"b"}
+{"status":"Downloading","progressDetail":{"current":1024,"total":2048},"id":"b"}
+{"status":"Download complete","progressDetail":{},"id":"b"}
+{"status":"Extracting","progressDetail":{"current":2048,"total":2048},"id":"b"}
+{"status":"Pull complete","progressDetail":{},"id":"b"}
+{"status":"Digest: sha256:abc"}
+{"status":"Status: Downloaded newer image for alpine:3"}
+`)
+	out := new(bytes.Buffer)
+	stats, err := CopyPull(in, out, "alpine:3", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Layers != 2 || stats.LayersDone != 2 || stats.Bytes != 2048 {
+		t.Errorf("Unexpected pull stats %+v", stats)
+	}
+	for _, want := range []string{
+		"3: Pulling from library/alpine\n",
+		"Pulling alpine:3: 1/2 layers, 512B of 2.048kB downloaded",
+		"Digest: sha256:abc\n",
+		"Pulled alpine:3: 2 layers, 2.048kB downloaded in ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Want output to contain %q, got %q", want, out.String())
+		}
+	}
+}
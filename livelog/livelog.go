@@ -7,13 +7,14 @@ package livelog
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 
 	"github.com/harness/harness-docker-runner/logstream"
@@ -23,11 +24,26 @@ const (
 	defaultInterval = 1 * time.Second
 	defaultLevel    = "info"
 	defaultLimit    = 5242880 // 5MB
+
+	// by default a fifth of the limit is used to keep the start of
+	// the logs.
+	defaultHeadRatio = 5
+	timestampFormat  = "2006-01-02T15:04:05.000Z"
+
+	// maximum number of matches kept per nudge.
+	maxNudgeMatches = 10
 )
 
+// NudgeMatch is a nudge whose search term was found in the logs.
+type NudgeMatch struct {
+	Nudge logstream.Nudge
+	Line  *logstream.Line
+}
+
 // Writer is an io.Writer that sends logs to the server.
 type Writer struct {
 	mu sync.Mutex
+	wm sync.Mutex // serializes writes from the stdout and stderr streams
 
 	client logstream.Client // client
 
@@ -36,16 +52,30 @@ type Writer struct {
 
 	num    int
 	now    time.Time
-	size   int
+	size   int // size of the history
 	limit  int
 	opened bool // whether the stream has been successfully opened
 	nudges []logstream.Nudge
 	errs   []error
 
+	matches [][]*logstream.Line // most recent lines matched by each nudge
+
 	interval time.Duration
 	pending  []*logstream.Line
 	history  []*logstream.Line
-	prev     []byte
+	head     []*logstream.Line // lines at the start of the logs that are kept
+
+	headSize       int
+	headMax        int             // bytes at the start of the logs that are kept, -1 for the default
+	truncated      int             // number of lines dropped from the history
+	truncatedBytes int             // size of the lines dropped from the history
+	truncatedFrom  *logstream.Line // first line dropped from the history
+
+	prev     map[string][]byte    // partial line of each stream
+	prevTime map[string]time.Time // time the partial line of each stream was produced
+
+	showTimestamps bool
+	classifier     logstream.Classifier
 
 	closed            bool
 	trimNewLineSuffix bool
@@ -61,11 +91,16 @@ func New(client logstream.Client, key, name string, nudges []logstream.Nudge, tr
 		name:              name,
 		now:               time.Now(),
 		limit:             defaultLimit,
+		headMax:           -1,
 		interval:          defaultInterval,
+		prev:              map[string][]byte{},
+		prevTime:          map[string]time.Time{},
 		nudges:            nudges,
+		matches:           make([][]*logstream.Line, len(nudges)),
 		close:             make(chan struct{}),
 		ready:             make(chan struct{}, 1),
 		trimNewLineSuffix: trimNewLineSuffix,
+		classifier:        logstream.DefaultClassifier(),
 	}
 	go b.Start()
 	return b
@@ -76,6 +111,25 @@ func (b *Writer) SetLimit(limit int) {
 	b.limit = limit
 }
 
+// SetHeadLimit sets the number of bytes at the start of the logs
+// that are kept when the logs exceed the limit. It defaults to a
+// fifth of the limit.
+func (b *Writer) SetHeadLimit(limit int) {
+	b.headMax = limit
+}
+
+// SetShowTimestamps sets whether the time each line was produced
+// is prepended to the line.
+func (b *Writer) SetShowTimestamps(show bool) {
+	b.showTimestamps = show
+}
+
+// SetClassifier sets the classifier that detects the level and
+// structured fields of each line. A nil classifier disables it.
+func (b *Writer) SetClassifier(classifier logstream.Classifier) {
+	b.classifier = classifier
+}
+
 // SetInterval sets the Writer flusher interval.
 func (b *Writer) SetInterval(interval time.Duration) {
 	b.interval = interval
@@ -83,12 +137,32 @@ func (b *Writer) SetInterval(interval time.Duration) {
 
 // Write uploads the live log stream to the server.
 func (b *Writer) Write(p []byte) (n int, err error) {
+	return b.WriteStream("", time.Time{}, p)
+}
+
+// WriteStream uploads the live log stream to the server, tagging the
+// lines with the stream they were written to. Partial lines are
+// buffered per stream so that interleaved stdout and stderr output
+// is not merged into the same line. The lines are stamped with ts,
+// or the current time if ts is zero.
+func (b *Writer) WriteStream(stream string, ts time.Time, p []byte) (n int, err error) {
+	b.wm.Lock()
+	defer b.wm.Unlock()
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	// a line is stamped with the time its first part was produced.
+	if len(b.prev[stream]) == 0 {
+		b.prevTime[stream] = ts
+	}
+
 	var res []byte
 	// Return if a new line character is not present in the input.
 	// Commands like `mvn` flush character by character so this prevents
 	// spamming of single-character logs.
 	if !bytes.Contains(p, []byte("\n")) {
-		b.prev = append(b.prev, p...)
+		b.prev[stream] = append(b.prev[stream], p...)
 		return len(p), nil
 	}
 
@@ -99,9 +173,11 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 	//     Write(BC\nDEF\nGH) ---> res becomes ABC\nDEF\n and prev becomes GH
 	first, second := splitLast(p)
 
-	res = b.prev
+	res = b.prev[stream]
 	res = append(res, first...)
-	b.prev = second
+	b.prev[stream] = second
+	lineTime := b.prevTime[stream]
+	b.prevTime[stream] = ts
 
 	for _, part := range split(res) {
 		if part == "" {
@@ -116,26 +192,25 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 			Level:       defaultLevel,
 			Message:     part,
 			Number:      b.num,
-			Timestamp:   time.Now(),
-			ElaspedTime: int64(time.Since(b.now).Seconds()),
+			Timestamp:   lineTime,
+			ElaspedTime: int64(lineTime.Sub(b.now).Seconds()),
+			Stream:      stream,
 		}
-		logrus.WithField("name", b.name).Infoln(line.Message)
-
-		for b.size+len(part) > b.limit {
-			// Keep streaming even after the limit, but only upload last `b.limit` data to the store
-			if len(b.history) == 0 {
-				break
-			}
+		if b.classifier != nil {
+			b.classifier.Classify(line)
+		}
+		// the nudges are matched against the output, without the
+		// timestamp, so that anchored search terms match.
+		b.matchNudges(line, part)
 
-			hline, err := json.Marshal(b.history[0])
-			if err != nil {
-				logrus.WithError(err).WithField("name", b.name).Errorln("could not marshal log")
-			}
-			b.size -= len(hline)
-			b.history = b.history[1:]
+		if b.showTimestamps {
+			part = lineTime.UTC().Format(timestampFormat) + " " + part
+			line.Message = part
 		}
+		// the remaining lines of the write were produced at ts.
+		lineTime = ts
+		logrus.WithField("name", b.name).Infoln(line.Message)
 
-		b.size += len(part)
 		b.num++
 
 		if !b.stopped() {
@@ -145,7 +220,7 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 		}
 
 		b.mu.Lock()
-		b.history = append(b.history, line)
+		b.retain(line)
 		b.mu.Unlock()
 	}
 
@@ -173,9 +248,18 @@ func (b *Writer) Open() error {
 // the server.
 func (b *Writer) Close() error {
 	if b.stop() {
-		// Flush anything waiting on a new line
-		if len(b.prev) > 0 {
-			b.Write([]byte("\n")) // nolint:errcheck
+		// Flush anything waiting on a new line. The streams may
+		// still be written to if their writers outlived the step.
+		b.wm.Lock()
+		var pending []string
+		for stream, prev := range b.prev {
+			if len(prev) > 0 {
+				pending = append(pending, stream)
+			}
+		}
+		b.wm.Unlock()
+		for _, stream := range pending {
+			b.WriteStream(stream, time.Time{}, []byte("\n")) // nolint:errcheck
 		}
 		b.flush()
 	}
@@ -192,9 +276,78 @@ func (b *Writer) Close() error {
 	return err
 }
 
+// retain adds the line to the history uploaded to the server. The
+// first headLimit bytes of the logs are kept, and the last bytes up
+// to the limit. The lines in between are dropped.
+func (b *Writer) retain(line *logstream.Line) {
+	size := len(line.Message)
+	if len(b.history) == 0 && b.truncated == 0 && b.headSize+size <= b.headLimit() {
+		b.head = append(b.head, line)
+		b.headSize += size
+		return
+	}
+
+	// Keep streaming even after the limit, but only upload the
+	// start and the end of the logs to the store
+	b.history = append(b.history, line)
+	b.size += size
+	for b.headSize+b.size > b.limit && len(b.history) > 0 {
+		if b.truncated == 0 {
+			b.truncatedFrom = b.history[0]
+		}
+		dropped := len(b.history[0].Message)
+		b.size -= dropped
+		b.truncated++
+		b.truncatedBytes += dropped
+		b.history = b.history[1:]
+	}
+}
+
+// headLimit returns the number of bytes at the start of the logs
+// that are kept.
+func (b *Writer) headLimit() int {
+	if b.headMax >= 0 && b.headMax <= b.limit {
+		return b.headMax
+	}
+	return b.limit / defaultHeadRatio
+}
+
+// lines returns the lines that are uploaded to the server, with a
+// marker line in place of the truncated lines.
+func (b *Writer) lines() []*logstream.Line {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := make([]*logstream.Line, 0, len(b.head)+len(b.history)+1)
+	lines = append(lines, b.head...)
+	if b.truncated > 0 {
+		msg := fmt.Sprintf("... %d lines (%s) truncated ...", b.truncated, units.HumanSize(float64(b.truncatedBytes)))
+		if !b.trimNewLineSuffix {
+			msg += "\n"
+		}
+		lines = append(lines, &logstream.Line{
+			Level:       logstream.LevelWarn,
+			Message:     msg,
+			Number:      b.truncatedFrom.Number,
+			Timestamp:   b.truncatedFrom.Timestamp,
+			ElaspedTime: b.truncatedFrom.ElaspedTime,
+			Args:        map[string]string{"truncated_lines": strconv.Itoa(b.truncated)},
+		})
+	}
+	return append(lines, b.history...)
+}
+
+// Truncated returns the number of lines, and their size in bytes,
+// that were dropped from the uploaded logs.
+func (b *Writer) Truncated() (lines, bytes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.truncated, b.truncatedBytes
+}
+
 // upload uploads the full log history to the server.
 func (b *Writer) upload() error {
-	return b.client.Upload(context.Background(), b.key, b.history)
+	return b.client.Upload(context.Background(), b.key, b.lines())
 }
 
 // flush batch uploads all buffered logs to the server.
@@ -277,21 +430,48 @@ func (b *Writer) Start() {
 	}
 }
 
-func (b *Writer) checkErrInLogs() {
-	size := len(b.history)
-	// Check last 10 log lines for errors. TODO(Shubham): see if this can be made better
-	for idx := max(0, size-10); idx < size; idx++ { // nolint:gomnd
-		line := b.history[idx]
-		// Iterate over the nudges and see if we get a match
-		for _, n := range b.nudges {
-			r, err := regexp.Compile(n.GetSearch())
-			if err != nil {
-				logrus.WithError(err).WithField("key", b.key).Errorln("error while compiling regex")
+// matchNudges records the nudges whose search term is found in
+// the output of the line.
+func (b *Writer) matchNudges(line *logstream.Line, output string) {
+	for i, n := range b.nudges {
+		if !n.Match(output) {
+			continue
+		}
+		b.mu.Lock()
+		matches := append(b.matches[i], line)
+		if len(matches) > maxNudgeMatches {
+			matches = matches[1:]
+		}
+		b.matches[i] = matches
+		b.mu.Unlock()
+	}
+}
+
+// Nudges returns the nudges whose search term was found within
+// their window at the end of the logs, ordered by line.
+func (b *Writer) Nudges() []NudgeMatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []NudgeMatch
+	for i, n := range b.nudges {
+		for _, line := range b.matches[i] {
+			if w := n.GetWindow(); w > 0 && line.Number < b.num-w {
 				continue
 			}
-			if r.MatchString(line.Message) {
-				b.errs = append(b.errs, formatNudge(line, n))
-			}
+			out = append(out, NudgeMatch{Nudge: n, Line: line})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Line.Number < out[j].Line.Number
+	})
+	return out
+}
+
+func (b *Writer) checkErrInLogs() {
+	for _, m := range b.Nudges() {
+		if m.Nudge.GetSeverity() == logstream.SeverityError {
+			b.errs = append(b.errs, formatNudge(m.Line, m.Nudge))
 		}
 	}
 }
@@ -329,10 +509,3 @@ func formatNudge(line *logstream.Line, nudge logstream.Nudge) error {
 	return fmt.Errorf("found possible error on line %d.\n Log: %s.\n Possible error: %s.\n Possible resolution: %s",
 		line.Number+1, line.Message, nudge.GetError(), nudge.GetResolution())
 }
-
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
-}
@@ -66,6 +66,152 @@ func TestLineWriterSingleWithTrimNewLineSuffixEnabled(t *testing.T) {
 	}
 }
 
+func TestLineWriterStreams(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false)
+	w.SetInterval(time.Duration(0))
+	w.WriteStream(logstream.Stdout, time.Time{}, []byte("fo"))    // nolint:errcheck
+	w.WriteStream(logstream.Stderr, time.Time{}, []byte("err\n")) // nolint:errcheck
+	w.WriteStream(logstream.Stdout, time.Time{}, []byte("o\n"))   // nolint:errcheck
+	w.Close()
+
+	a := client.uploaded
+	b := []*logstream.Line{
+		{Number: 0, Message: "err\n"},
+		{Number: 1, Message: "foo\n"},
+	}
+	if err := compare(a, b); err != nil {
+		t.Fail()
+		t.Log(err)
+	}
+	if a[0].Stream != logstream.Stderr || a[1].Stream != logstream.Stdout {
+		t.Errorf("expected lines to be tagged with their stream, got %q and %q", a[0].Stream, a[1].Stream)
+	}
+}
+
+func TestLineWriterCloseWhileWriting(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false)
+	w.SetInterval(time.Hour)
+
+	// the writers of the streams can outlive the step.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			w.WriteStream(fmt.Sprintf("stream-%d", i%16), time.Time{}, []byte("partial")) // nolint:errcheck
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		w.WriteStream(logstream.Stdout, time.Time{}, []byte("line")) // nolint:errcheck
+	}
+	w.Close()
+	close(stop)
+	<-done
+}
+
+func TestLineWriterTimestamps(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false)
+	w.SetInterval(time.Duration(0))
+	w.SetShowTimestamps(true)
+	ts := time.Date(2022, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	w.WriteStream(logstream.Stdout, ts, []byte("fo"))                   // nolint:errcheck
+	w.WriteStream(logstream.Stdout, ts.Add(time.Second), []byte("o\n")) // nolint:errcheck
+	w.Close()
+
+	a := client.uploaded
+	b := []*logstream.Line{
+		{Number: 0, Message: "2022-03-04T05:06:07.890Z foo\n"},
+	}
+	if err := compare(a, b); err != nil {
+		t.Fail()
+		t.Log(err)
+	}
+	if !a[0].Timestamp.Equal(ts) {
+		t.Errorf("expected line to be stamped with %s, got %s", ts, a[0].Timestamp)
+	}
+}
+
+func TestLineWriterNudges(t *testing.T) {
+	oom, _ := logstream.NewNudgeFromRule(logstream.NudgeRule{Search: "[Kk]illed", Error: "out of memory", Window: 2})
+	disk, _ := logstream.NewNudgeFromRule(logstream.NudgeRule{Search: "no space left", Error: "out of disk", Severity: "warning"})
+
+	client := new(mockClient)
+	w := New(client, "1", "1", []logstream.Nudge{oom, disk}, false)
+	w.Write([]byte("killed early\nno space left\n")) // nolint:errcheck
+	w.Write([]byte("foo\nbar\nKilled\n"))            // nolint:errcheck
+	w.Close()
+
+	nudges := w.Nudges()
+	if len(nudges) != 2 {
+		t.Fatalf("Want 2 nudges, got %d", len(nudges))
+	}
+	// the first oom match is outside the window of the nudge.
+	if got := nudges[0]; got.Nudge != disk || got.Line.Number != 1 {
+		t.Errorf("Want disk nudge on line 1, got %s on line %d", got.Nudge.GetError(), got.Line.Number)
+	}
+	if got := nudges[1]; got.Nudge != oom || got.Line.Number != 4 {
+		t.Errorf("Want oom nudge on line 4, got %s on line %d", got.Nudge.GetError(), got.Line.Number)
+	}
+	// only error nudges are reported as errors.
+	if len(w.errs) != 1 {
+		t.Errorf("Want 1 error, got %d", len(w.errs))
+	}
+}
+
+func TestLineWriterNudgesTimestamps(t *testing.T) {
+	// the error of the nudge defaults to the search term.
+	fatal, _ := logstream.NewNudgeFromRule(logstream.NudgeRule{Search: "^fatal:"})
+
+	client := new(mockClient)
+	w := New(client, "1", "1", []logstream.Nudge{fatal}, false)
+	w.SetShowTimestamps(true)
+	w.Write([]byte("fatal: repository not found\n")) // nolint:errcheck
+	w.Close()
+
+	nudges := w.Nudges()
+	if len(nudges) != 1 {
+		t.Fatalf("Want the anchored nudge matched despite the timestamp, got %d nudges", len(nudges))
+	}
+	if got, want := nudges[0].Nudge.GetError().Error(), `found "^fatal:" in the logs`; got != want {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+}
+
+func TestLineWriterTruncate(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false)
+	w.SetLimit(20)
+	w.SetHeadLimit(8)
+	for i := 0; i < 10; i++ {
+		w.Write([]byte(fmt.Sprintf("line%d\n", i))) // nolint:errcheck
+	}
+	w.Close()
+
+	want := []string{"line0\n", "... 7 lines (42B) truncated ...\n", "line8\n", "line9\n"}
+	if len(client.uploaded) != len(want) {
+		t.Fatalf("Want %d lines uploaded, got %d", len(want), len(client.uploaded))
+	}
+	for i, line := range client.uploaded {
+		if line.Message != want[i] {
+			t.Errorf("Want line %q, got %q", want[i], line.Message)
+		}
+	}
+	if got := client.uploaded[1].Number; got != 1 {
+		t.Errorf("Want marker at line 1, got %d", got)
+	}
+	if lines, bytes := w.Truncated(); lines != 7 || bytes != 42 {
+		t.Errorf("Want 7 lines and 42 bytes truncated, got %d and %d", lines, bytes)
+	}
+}
+
 func compare(a, b []*logstream.Line) error {
 	if len(a) != len(b) {
 		return fmt.Errorf("expected size: %d, actual: %d", len(a), len(b))
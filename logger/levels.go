@@ -0,0 +1,135 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// module is the import path of the runner packages.
+const module = "github.com/harness/harness-docker-runner/"
+
+// ComponentField is the field of an entry that names the component
+// that logged it. The component of an entry without the field is the
+// package of the caller, relative to the module, eg engine/docker.
+const ComponentField = "component"
+
+// LevelFormatter drops the entries that are below the level of their
+// component, and formats the others with the wrapped formatter.
+type LevelFormatter struct {
+	logrus.Formatter
+
+	// Level is the level of the components with no level.
+	Level logrus.Level
+	// Levels is the level of the components. The level of a
+	// component applies to its sub-packages, eg the level of
+	// engine applies to engine/docker.
+	Levels map[string]logrus.Level
+}
+
+// ParseLevels parses the levels of the components.
+func ParseLevels(levels map[string]string) (map[string]logrus.Level, error) {
+	parsed := make(map[string]logrus.Level, len(levels))
+	for component, s := range levels {
+		level, err := logrus.ParseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level of component %s: %w", component, err)
+		}
+		parsed[strings.Trim(component, "/")] = level
+	}
+	return parsed, nil
+}
+
+// MaxLevel returns the most verbose of the levels, which the logger
+// must be set to for the entries to reach the formatter.
+func (f *LevelFormatter) MaxLevel() logrus.Level {
+	max := f.Level
+	for _, level := range f.Levels {
+		if level > max {
+			max = level
+		}
+	}
+	return max
+}
+
+// Format formats the entry, or returns nothing if it is dropped.
+func (f *LevelFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	if e.Level > f.level(component(e)) {
+		return nil, nil
+	}
+	return f.Formatter.Format(e)
+}
+
+// level returns the level of the component, which is the level of
+// its closest configured parent.
+func (f *LevelFormatter) level(component string) logrus.Level {
+	for component != "" {
+		if level, ok := f.Levels[component]; ok {
+			return level
+		}
+		i := strings.LastIndex(component, "/")
+		if i < 0 {
+			break
+		}
+		component = component[:i]
+	}
+	return f.Level
+}
+
+// component returns the component that logged the entry.
+func component(e *logrus.Entry) string {
+	if s, ok := e.Data[ComponentField].(string); ok {
+		return s
+	}
+	if e.Caller == nil {
+		return ""
+	}
+	return callerPackage(e.Caller)
+}
+
+// callerPackage returns the package of the caller relative to the
+// module, or an empty string if the caller is not a runner package.
+func callerPackage(f *runtime.Frame) string {
+	// the function is qualified with the package import path,
+	// eg github.com/org/repo/engine/docker.(*Docker).Run
+	fn := f.Function
+	if !strings.HasPrefix(fn, module) {
+		return ""
+	}
+	fn = strings.TrimPrefix(fn, module)
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// HideCaller is a caller prettyfier that omits the caller, which is
+// only reported to resolve the component of the entries.
+func HideCaller(*runtime.Frame) (function, file string) {
+	return "", ""
+}
+
+// SkipEmpty returns a writer that skips the empty writes of the
+// entries dropped by the LevelFormatter.
+func SkipEmpty(w io.Writer) io.Writer {
+	return skipEmpty{w}
+}
+
+type skipEmpty struct {
+	io.Writer
+}
+
+func (w skipEmpty) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return w.Writer.Write(p)
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLevelFormatter(t *testing.T) {
+	levels, err := ParseLevels(map[string]string{
+		"engine":        "warn",
+		"engine/docker": "debug",
+		"logger":        "error",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &LevelFormatter{
+		Formatter: &logrus.TextFormatter{DisableTimestamp: true, CallerPrettyfier: HideCaller},
+		Level:     logrus.InfoLevel,
+		Levels:    levels,
+	}
+	if got, want := f.MaxLevel(), logrus.DebugLevel; got != want {
+		t.Errorf("want max level %s, got %s", want, got)
+	}
+
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(SkipEmpty(&buf))
+	l.SetFormatter(f)
+	l.SetLevel(f.MaxLevel())
+	l.SetReportCaller(true)
+
+	l.WithField(ComponentField, "engine/docker/image").Debugln("docker debug")
+	l.WithField(ComponentField, "engine/exec").Infoln("exec info")
+	l.WithField(ComponentField, "engine/exec").Warnln("exec warn")
+	l.WithField(ComponentField, "handler").Debugln("handler debug")
+	l.WithField(ComponentField, "handler").Infoln("handler info")
+	// the component of the entries without the field is the
+	// package of the caller.
+	l.Warnln("logger warn")
+	l.Errorln("logger error")
+
+	out := buf.String()
+	for _, s := range []string{"docker debug", "exec warn", "handler info", "logger error"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("want %q logged, got %q", s, out)
+		}
+	}
+	for _, s := range []string{"exec info", "handler debug", "logger warn", "func=", "file="} {
+		if strings.Contains(out, s) {
+			t.Errorf("want %q dropped, got %q", s, out)
+		}
+	}
+}
+
+func TestParseLevelsInvalid(t *testing.T) {
+	if _, err := ParseLevels(map[string]string{"engine": "loud"}); err == nil {
+		t.Errorf("want error for invalid level")
+	}
+}
+
+func TestCallerPackage(t *testing.T) {
+	tests := map[string]string{
+		module + "engine/docker.(*Docker).Run":        "engine/docker",
+		module + "logstream/remote.uploadLines.func1": "logstream/remote",
+		module + "handler.HandleSetup.func1":          "handler",
+		"github.com/sirupsen/logrus.(*Entry).Log":     "",
+		"main.main": "",
+	}
+	for fn, want := range tests {
+		if got := callerPackage(&runtime.Frame{Function: fn}); got != want {
+			t.Errorf("%s: want component %q, got %q", fn, want, got)
+		}
+	}
+}
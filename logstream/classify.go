@@ -0,0 +1,157 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Levels of a log line.
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
+// Classifier classifies log lines, setting the level of the line
+// and extracting structured fields from the message into the args
+// of the line.
+type Classifier interface {
+	Classify(line *Line)
+}
+
+// ClassifierFunc is an adapter to use a function as a Classifier.
+type ClassifierFunc func(line *Line)
+
+// Classify calls f(line).
+func (f ClassifierFunc) Classify(line *Line) {
+	f(line)
+}
+
+// Classifiers applies each classifier in order.
+type Classifiers []Classifier
+
+// Classify classifies the line with each classifier.
+func (c Classifiers) Classify(line *Line) {
+	for _, classifier := range c {
+		classifier.Classify(line)
+	}
+}
+
+var (
+	ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+	// level prefixes, e.g. "ERROR ...", "[WARNING] ...", "error: ...",
+	// "npm ERR! ...", or a level field in logfmt or json output.
+	levelRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^\s*(?:npm |yarn )?\[?(error|err!?|fatal|panic|critical|severe|failure|warn(?:ing)?|info|debug|trace)\b\]?[\s:!]`),
+		regexp.MustCompile(`(?i)(?:^|\s)(?:level|lvl|severity)=["']?(error|err|fatal|panic|critical|warn(?:ing)?|info|debug|trace)\b`),
+		regexp.MustCompile(`(?i)"(?:level|lvl|severity)"\s*:\s*"(error|err|fatal|panic|critical|warn(?:ing)?|info|debug|trace)"`),
+		// compiler output, e.g. "main.go:12:3: error: ..."
+		regexp.MustCompile(`(?i)^\S+:\d+(?::\d+)?:\s*(error|fatal error|warning)\b`),
+	}
+
+	// references to source files, e.g. "pkg/main.go:12:3",
+	// "(Foo.java:42)" or "Foo.java:[12,5]".
+	fileRegexp = regexp.MustCompile(`(?:^|[\s("'])(/?(?:[\w.\-]+/)*[\w\-]+\.(?:go|java|kt|kts|scala|groovy|gradle|py|rb|js|jsx|mjs|ts|tsx|c|cc|cpp|cxx|h|hpp|cs|rs|swift|m|php|sh|tf|yaml|yml|json|xml)):\[?(\d+)(?:[:,](\d+))?`)
+
+	// test results, e.g. "--- FAIL: TestFoo (0.00s)",
+	// "FAILED tests/test_foo.py::test_bar" or
+	// "testBar(com.example.FooTest)  Time elapsed: 0.1 s  <<< FAILURE!"
+	testRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*--- (FAIL|PASS|SKIP): (\S+)`),
+		regexp.MustCompile(`^\s*(FAILED|PASSED|ERROR|SKIPPED) (\S+::\S+)`),
+		regexp.MustCompile(`^(?:\[ERROR\] )?\s*(?:Tests run:.*in )?([\w.$]+(?:\([\w.$]+\))?).*<<< (FAILURE|ERROR)!`),
+	}
+)
+
+// DefaultClassifier returns the classifier that detects the level
+// of common log formats, and extracts references to source files
+// and test results.
+func DefaultClassifier() Classifier {
+	return Classifiers{
+		ClassifierFunc(classifyLevel),
+		ClassifierFunc(classifyFile),
+		ClassifierFunc(classifyTest),
+	}
+}
+
+// classifyLevel detects the level from the prefix of the message.
+// Lines written to stderr without a level are warnings.
+func classifyLevel(line *Line) {
+	msg := ansiRegexp.ReplaceAllString(line.Message, "")
+	for _, r := range levelRegexps {
+		if m := r.FindStringSubmatch(msg); m != nil {
+			line.Level = normalizeLevel(m[1])
+			return
+		}
+	}
+	if line.Stream == Stderr {
+		line.Level = LevelWarn
+	}
+}
+
+// classifyFile extracts the first reference to a source file.
+func classifyFile(line *Line) {
+	m := fileRegexp.FindStringSubmatch(ansiRegexp.ReplaceAllString(line.Message, ""))
+	if m == nil {
+		return
+	}
+	setArg(line, "file", m[1])
+	setArg(line, "line", m[2])
+	if m[3] != "" {
+		setArg(line, "column", m[3])
+	}
+}
+
+// classifyTest extracts the name and result of a test.
+func classifyTest(line *Line) {
+	msg := ansiRegexp.ReplaceAllString(line.Message, "")
+	for i, r := range testRegexps {
+		m := r.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		name, result := m[2], m[1]
+		if i == 2 { // nolint:gomnd
+			name, result = m[1], m[2]
+		}
+		result = strings.ToLower(result)
+		switch result {
+		case "fail", "failed", "failure", "error":
+			result = "fail"
+			line.Level = LevelError
+		case "passed":
+			result = "pass"
+		case "skipped":
+			result = "skip"
+		}
+		setArg(line, "test", name)
+		setArg(line, "test_result", result)
+		return
+	}
+}
+
+func normalizeLevel(level string) string {
+	switch strings.TrimSuffix(strings.ToLower(level), "!") {
+	case "error", "err", "fatal", "fatal error", "panic", "critical", "severe", "failure":
+		return LevelError
+	case "warn", "warning":
+		return LevelWarn
+	case "debug", "trace":
+		return LevelDebug
+	default:
+		return LevelInfo
+	}
+}
+
+func setArg(line *Line, key, value string) {
+	if line.Args == nil {
+		line.Args = map[string]string{}
+	}
+	line.Args[key] = value
+}
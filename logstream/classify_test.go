@@ -0,0 +1,76 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := []struct {
+		message string
+		stream  string
+		level   string
+		args    map[string]string
+	}{
+		{message: "compiling\n", level: LevelInfo},
+		{message: "ERROR something failed\n", level: LevelError},
+		{message: "[WARNING] deprecated api\n", level: LevelWarn},
+		{message: "\x1b[31merror:\x1b[0m cannot find module\n", level: LevelError},
+		{message: "npm ERR! code ELIFECYCLE\n", level: LevelError},
+		{message: `time="2022" level=debug msg="resolving"` + "\n", level: LevelDebug},
+		{message: `{"level":"warn","msg":"slow"}` + "\n", level: LevelWarn},
+		{message: "Cloning into 'repo'...\n", stream: Stderr, level: LevelWarn},
+		{message: "errors are fine in prose\n", level: LevelInfo},
+		{
+			message: "pkg/main.go:12:3: undefined: foo\n",
+			level:   LevelInfo,
+			args:    map[string]string{"file": "pkg/main.go", "line": "12", "column": "3"},
+		},
+		{
+			message: "src/foo.c:7:1: warning: unused variable\n",
+			level:   LevelWarn,
+			args:    map[string]string{"file": "src/foo.c", "line": "7", "column": "1"},
+		},
+		{
+			message: "\tat com.example.Foo.bar(Foo.java:42)\n",
+			level:   LevelInfo,
+			args:    map[string]string{"file": "Foo.java", "line": "42"},
+		},
+		{
+			message: "[ERROR] /src/Foo.java:[12,5] cannot find symbol\n",
+			level:   LevelError,
+			args:    map[string]string{"file": "/src/Foo.java", "line": "12", "column": "5"},
+		},
+		{
+			message: "--- FAIL: TestParse (0.00s)\n",
+			level:   LevelError,
+			args:    map[string]string{"test": "TestParse", "test_result": "fail"},
+		},
+		{
+			message: "PASSED tests/test_api.py::test_get\n",
+			level:   LevelInfo,
+			args:    map[string]string{"test": "tests/test_api.py::test_get", "test_result": "pass"},
+		},
+		{
+			message: "testBar(com.example.FooTest)  Time elapsed: 0.1 s  <<< FAILURE!\n",
+			level:   LevelError,
+			args:    map[string]string{"test": "testBar(com.example.FooTest)", "test_result": "fail"},
+		},
+		{message: "http://example.com:8080/health\n", level: LevelInfo},
+	}
+	classifier := DefaultClassifier()
+	for _, test := range tests {
+		line := &Line{Level: LevelInfo, Message: test.message, Stream: test.stream}
+		classifier.Classify(line)
+		if line.Level != test.level {
+			t.Errorf("%q: want level %s, got %s", test.message, test.level, line.Level)
+		}
+		if !reflect.DeepEqual(line.Args, test.args) {
+			t.Errorf("%q: want args %v, got %v", test.message, test.args, line.Args)
+		}
+	}
+}
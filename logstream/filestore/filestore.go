@@ -9,14 +9,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 
-	"github.com/drone/drone-go/drone"
 	"github.com/sirupsen/logrus"
 
 	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/logstream/remote"
+)
+
+const (
+	// streamFile holds the lines written while the step runs.
+	streamFile = "stream.jsonl"
+	// logsFile holds the full logs uploaded once the step completed.
+	logsFile = "logs.jsonl"
 )
 
 func New(relPath string) *FileStore {
@@ -27,25 +36,73 @@ func New(relPath string) *FileStore {
 	}
 }
 
+// State is the state of an open data stream. It is removed once
+// the stream is closed.
 type State struct {
-	completed bool
-	file      *os.File
+	file *os.File
 }
 
-// FileStore provides a file store client.
+// FileStore provides a file store client. The logs of each key
+// are stored in a directory of their own, as newline delimited
+// json in the same format as the log service.
 type FileStore struct {
 	mu      sync.Mutex
 	relPath string
 	state   map[string]State
 }
 
+// Upload writes the full logs of the key. The lines written to the
+// data stream are removed, since they are included in the logs.
 func (f *FileStore) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	dir, err := keyDir(f.relPath, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return err
+	}
+	data, err := encode(lines)
+	if err != nil {
+		logrus.WithError(err).WithField("key", key).
+			Errorln("failed to encode lines")
+		return err
+	}
+
+	// write to a temporary file first so that readers never see
+	// partially written logs.
+	tmp := filepath.Join(dir, logsFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil { // nolint:gomnd
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, logsFile)); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	s, ok := f.state[key]
+	f.mu.Unlock()
+	if ok && s.file != nil {
+		// the stream is closed after the upload, the file is
+		// removed once closed.
+		return nil
+	}
+	if err := os.Remove(filepath.Join(dir, streamFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
 // Open opens the data stream.
 func (f *FileStore) Open(ctx context.Context, key string) error {
-	file, err := os.Create(path.Join(f.relPath, key))
+	dir, err := keyDir(f.relPath, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return err
+	}
+	file, err := os.Create(filepath.Join(dir, streamFile))
 	if err != nil {
 		return err
 	}
@@ -65,22 +122,24 @@ func (f *FileStore) Close(ctx context.Context, key string) error {
 
 	err = file.Close()
 	f.mu.Lock()
-	f.state[key] = State{completed: true, file: f.state[key].file}
+	delete(f.state, key)
 	f.mu.Unlock()
+
+	// the data stream is no longer needed if the full logs
+	// were uploaded.
+	if _, serr := os.Stat(filepath.Join(filepath.Dir(file.Name()), logsFile)); serr == nil {
+		os.Remove(file.Name())
+	}
 	return err
 }
 
 // Write writes logs to the file.
 func (f *FileStore) Write(ctx context.Context, key string, lines []*logstream.Line) error {
-	data := new(bytes.Buffer)
-	for _, line := range convertLines(lines) {
-		buf := new(bytes.Buffer)
-		if err := json.NewEncoder(buf).Encode(line); err != nil {
-			logrus.WithError(err).WithField("key", key).
-				Errorln("failed to encode line")
-			return err
-		}
-		data.Write(buf.Bytes())
+	data, err := encode(lines)
+	if err != nil {
+		logrus.WithError(err).WithField("key", key).
+			Errorln("failed to encode line")
+		return err
 	}
 
 	file, err := f.getFileRef(key)
@@ -88,7 +147,7 @@ func (f *FileStore) Write(ctx context.Context, key string, lines []*logstream.Li
 		return err
 	}
 
-	if _, err = file.Write(data.Bytes()); err != nil {
+	if _, err = file.Write(data); err != nil {
 		return err
 	}
 	return file.Sync()
@@ -105,13 +164,66 @@ func (f *FileStore) getFileRef(key string) (*os.File, error) {
 	return s.file, nil
 }
 
-func convertLines(lines []*logstream.Line) []*drone.Line {
-	var res []*drone.Line
+// keyDir returns the directory the logs of the key are stored in.
+// Each element of the key is a directory, with the characters that
+// are not safe in file names percent-escaped, so that distinct keys
+// never share a directory. Upper case letters are escaped as well,
+// since file names are not case sensitive on every platform. The
+// leading and trailing slashes of the key are ignored.
+func keyDir(root, key string) (string, error) {
+	key = strings.Trim(key, "/")
+	if key == "" {
+		return "", errors.New("invalid log key")
+	}
+	elems := []string{root}
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" {
+			return "", errors.New("invalid log key")
+		}
+		elems = append(elems, escapeElem(elem))
+	}
+	return filepath.Join(elems...), nil
+}
+
+// helper function percent-escapes the element of a key. The dot
+// elements are escaped so that they do not refer to a directory.
+func escapeElem(elem string) string {
+	if elem == "." || elem == ".." {
+		return strings.Repeat("%2E", len(elem))
+	}
+	var b strings.Builder
+	for i := 0; i < len(elem); i++ {
+		c := elem[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func encode(lines []*logstream.Line) ([]byte, error) {
+	data := new(bytes.Buffer)
+	enc := json.NewEncoder(data)
+	for _, line := range convertLines(lines) {
+		if err := enc.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	return data.Bytes(), nil
+}
+
+func convertLines(lines []*logstream.Line) []*remote.Line {
+	var res []*remote.Line
 	for _, l := range lines {
-		res = append(res, &drone.Line{
+		res = append(res, &remote.Line{
+			Level:     l.Level,
 			Message:   l.Message,
 			Number:    l.Number,
-			Timestamp: l.ElaspedTime,
+			Timestamp: l.Timestamp,
+			Args:      l.Fields(),
 		})
 	}
 	return res
@@ -0,0 +1,146 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/logstream/remote"
+)
+
+func TestFileStore(t *testing.T) {
+	root := t.TempDir()
+	key := "account:1/pipeline:2/../stage:3/step:4"
+	f := New(root)
+	ctx := context.Background()
+
+	if err := f.Open(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(ctx, key, []*logstream.Line{{Number: 0, Message: "a\n"}, {Number: 1, Message: "b\n"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the streamed lines can be read while the step runs.
+	logs, lines := read(t, root, key, 0, 0)
+	if logs.Complete || logs.Total != 2 || len(lines) != 2 {
+		t.Errorf("Unexpected streamed logs %+v with %d lines", logs, len(lines))
+	}
+
+	var uploaded []*logstream.Line
+	for i := 0; i < 5; i++ {
+		uploaded = append(uploaded, &logstream.Line{Number: i, Message: fmt.Sprintf("line%d\n", i)})
+	}
+	if err := f.Upload(ctx, key, uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.state) != 0 {
+		t.Errorf("Want state of the closed stream removed, got %v", f.state)
+	}
+
+	dir := filepath.Join(root, "account%3A1", "pipeline%3A2", "%2E%2E", "stage%3A3", "step%3A4")
+	if _, err := os.Stat(filepath.Join(dir, streamFile)); !os.IsNotExist(err) {
+		t.Errorf("Want stream file removed once closed, got %v", err)
+	}
+
+	logs, lines = read(t, root, key, 1, 2)
+	if !logs.Complete || logs.Total != 5 || len(lines) != 2 || lines[0].Message != "line1\n" || lines[1].Message != "line2\n" {
+		t.Errorf("Unexpected logs %+v with lines %v", logs, lines)
+	}
+
+	if _, err := Read(root, "unknown", 0, 0, nil); !os.IsNotExist(err) {
+		t.Errorf("Want not exist error, got %v", err)
+	}
+}
+
+func TestKeyDir(t *testing.T) {
+	// the keys that were mapped to the same directory when the
+	// characters not safe in file names were replaced.
+	keys := []string{"a:b", "a_b", "a%3Ab", "A_b", "a/b", "a/../b", "a/%2E%2E/b"}
+	dirs := map[string]string{}
+	for _, key := range keys {
+		dir, err := keyDir("/logs", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, ok := dirs[strings.ToLower(dir)]; ok {
+			t.Errorf("Want distinct directories for keys %q and %q, got %s", key, other, dir)
+		}
+		dirs[strings.ToLower(dir)] = key
+	}
+	for _, key := range []string{"", "/", "a//b"} {
+		if _, err := keyDir("/logs", key); err == nil {
+			t.Errorf("Want key %q to be invalid", key)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	root := t.TempDir()
+	f := New(root)
+	ctx := context.Background()
+	for i, key := range []string{"old", "new", "expired"} {
+		if err := f.Upload(ctx, key, []*logstream.Line{{Message: "0123456789"}}); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-time.Duration(3-i) * time.Minute)
+		if key == "expired" {
+			modified = time.Now().Add(-2 * time.Hour)
+		}
+		if err := os.Chtimes(filepath.Join(root, key, logsFile), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the stream of a running step is kept, even if the store
+	// exceeds its size.
+	if err := f.Open(ctx, "running"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(ctx, "running", []*logstream.Line{{Message: "0123456789"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit fits the new logs and the running stream only.
+	r := &Retention{Root: root, MaxAge: time.Hour, MaxSize: size(t, root, "new", logsFile) + size(t, root, "running", streamFile)}
+	if err := r.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"old": false, "new": true, "expired": false, "running": true} {
+		_, err := os.Stat(filepath.Join(root, key))
+		if got := err == nil; got != want {
+			t.Errorf("Want %s kept %v, got %v", key, want, got)
+		}
+	}
+}
+
+func size(t *testing.T, root, key, name string) int64 {
+	info, err := os.Stat(filepath.Join(root, key, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func read(t *testing.T, root, key string, offset, limit int) (*Logs, []*remote.Line) {
+	var lines []*remote.Line
+	logs, err := Read(root, key, offset, limit, func(line *remote.Line) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs, lines
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package filestore
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/harness/harness-docker-runner/logstream/remote"
+)
+
+// maximum size of a line in the log files.
+const maxLineSize = 1024 * 1024
+
+// Logs describes the logs read from the file store.
+type Logs struct {
+	Key string `json:"key"`
+	// Complete is true if the step completed and the full logs
+	// were written, false if the logs are still streamed.
+	Complete bool `json:"complete"`
+	// Total is the number of lines of the logs.
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Lines  []*remote.Line `json:"lines"`
+}
+
+// Read reads the logs of the key stored in root, calling fn for each
+// line starting at offset. At most limit lines are read, or all the
+// lines if limit is zero. The returned logs do not include the lines.
+func Read(root, key string, offset, limit int, fn func(*remote.Line) error) (*Logs, error) {
+	dir, err := keyDir(root, key)
+	if err != nil {
+		return nil, err
+	}
+	logs := &Logs{Key: key, Offset: offset, Complete: true}
+	file, err := os.Open(filepath.Join(dir, logsFile))
+	if os.IsNotExist(err) {
+		logs.Complete = false
+		file, err = os.Open(filepath.Join(dir, streamFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize) // nolint:gomnd
+	for ; scanner.Scan(); logs.Total++ {
+		if logs.Total < offset || (limit > 0 && logs.Total >= offset+limit) {
+			continue
+		}
+		line := new(remote.Line)
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			// the last line of the stream may be partially
+			// written.
+			continue
+		}
+		if err := fn(line); err != nil {
+			return nil, err
+		}
+	}
+	return logs, scanner.Err()
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package filestore
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Retention removes the logs stored in a file store that exceed
+// its age or size limits.
+type Retention struct {
+	Root    string
+	MaxAge  time.Duration // logs not written to for longer are removed. Zero disables
+	MaxSize int64         // oldest completed logs are removed above this size. Zero disables
+}
+
+// logDir is a directory holding the logs of a key.
+type logDir struct {
+	path     string
+	size     int64
+	modified time.Time
+	complete bool
+}
+
+// Start applies the retention at every interval until the context
+// is canceled.
+func (r *Retention) Start(ctx context.Context, interval time.Duration) {
+	for {
+		if err := r.Apply(); err != nil {
+			logrus.WithError(err).WithField("root", r.Root).Warnln("filestore: failed to apply log retention")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Apply removes the logs that are older than the maximum age, then
+// the oldest completed logs until the store is within its maximum
+// size. Logs that are still streamed are only removed by age.
+func (r *Retention) Apply() error {
+	dirs, err := r.scan()
+	if err != nil {
+		return err
+	}
+	var total int64
+	var kept []*logDir
+	for _, d := range dirs {
+		if r.MaxAge > 0 && time.Since(d.modified) > r.MaxAge {
+			r.remove(d)
+			continue
+		}
+		total += d.size
+		kept = append(kept, d)
+	}
+	if r.MaxSize <= 0 {
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].modified.Before(kept[j].modified)
+	})
+	for _, d := range kept {
+		if total <= r.MaxSize {
+			break
+		}
+		if !d.complete {
+			continue
+		}
+		r.remove(d)
+		total -= d.size
+	}
+	return nil
+}
+
+// scan returns the directories holding logs.
+func (r *Retention) scan() ([]*logDir, error) {
+	dirs := map[string]*logDir{}
+	err := filepath.WalkDir(r.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() || (name != logsFile && name != streamFile) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		d, ok := dirs[dir]
+		if !ok {
+			d = &logDir{path: dir}
+			dirs[dir] = d
+		}
+		d.size += info.Size()
+		if info.ModTime().After(d.modified) {
+			d.modified = info.ModTime()
+		}
+		if name == logsFile {
+			d.complete = true
+		}
+		return nil
+	})
+	out := make([]*logDir, 0, len(dirs))
+	for _, d := range dirs {
+		out = append(out, d)
+	}
+	return out, err
+}
+
+// remove removes the logs of the directory, and the parent
+// directories left empty.
+func (r *Retention) remove(d *logDir) {
+	for _, name := range []string{logsFile, streamFile} {
+		if err := os.Remove(filepath.Join(d.path, name)); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("path", d.path).Warnln("filestore: failed to remove logs")
+		}
+	}
+	for dir := d.path; dir != r.Root && len(dir) > len(r.Root); dir = filepath.Dir(dir) {
+		// removing a directory that is not empty fails.
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+// maximum number of writes queued per sink. Writes to a sink that
+// does not keep up are dropped, its logs are still uploaded in full.
+const sinkQueueSize = 64
+
+// sinkTimeout is the maximum time a call to a sink may take,
+// including the time it is queued, so that a sink that hangs does
+// not hold back the calls of the client.
+var sinkTimeout = 5 * time.Minute
+
+// Sink is a named client the logs are written to.
+type Sink struct {
+	Name   string
+	Client Client
+}
+
+// multiClient is a client that writes the logs to several sinks.
+// Each sink processes the calls of a key in order, independently
+// of the other sinks, so that a slow or failing sink does not hold
+// back the others.
+type multiClient struct {
+	sinks []*sink
+}
+
+type sink struct {
+	Sink
+
+	mu     sync.Mutex           // guards queues
+	queues map[string]*keyQueue // calls queued for each key
+
+	em     sync.Mutex
+	failed map[string]bool  // keys whose stream could not be opened
+	errs   map[string]error // last error of each key
+}
+
+// NewMultiClient returns a client that writes the logs to each of
+// the sinks. A call fails only if it fails for every sink, the
+// errors of each sink are reported by SinkErrors.
+func NewMultiClient(sinks ...Sink) Client {
+	c := new(multiClient)
+	for _, s := range sinks {
+		c.sinks = append(c.sinks, &sink{
+			Sink:   s,
+			queues: map[string]*keyQueue{},
+			failed: map[string]bool{},
+			errs:   map[string]error{},
+		})
+	}
+	return c
+}
+
+// Open opens the data stream of each sink.
+func (c *multiClient) Open(ctx context.Context, key string) error {
+	return c.call(ctx, key, false, func(ctx context.Context, s *sink) error {
+		err := s.Client.Open(ctx, key)
+		if err != nil {
+			s.em.Lock()
+			s.failed[key] = true
+			s.em.Unlock()
+		}
+		return err
+	})
+}
+
+// Write queues the lines to be written to the data stream of each
+// sink whose stream is open. The lines of a key that is not opened,
+// or already closed, are ignored.
+func (c *multiClient) Write(ctx context.Context, key string, lines []*Line) error {
+	for _, s := range c.sinks {
+		s := s
+		s.em.Lock()
+		failed := s.failed[key]
+		s.em.Unlock()
+		if failed {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+		queued := s.enqueue(ctx, key, false, false, func() {
+			defer cancel()
+			if err := s.Client.Write(ctx, key, lines); err != nil {
+				s.setErr(key, err)
+			}
+		})
+		if !queued {
+			cancel()
+			s.setErr(key, fmt.Errorf("sink is not keeping up, dropped %d lines", len(lines)))
+		}
+	}
+	return nil
+}
+
+// Upload uploads the full logs to each sink.
+func (c *multiClient) Upload(ctx context.Context, key string, lines []*Line) error {
+	return c.call(ctx, key, false, func(ctx context.Context, s *sink) error {
+		return s.Client.Upload(ctx, key, lines)
+	})
+}
+
+// Close closes the data stream of each sink.
+func (c *multiClient) Close(ctx context.Context, key string) error {
+	err := c.call(ctx, key, true, func(ctx context.Context, s *sink) error {
+		return s.Client.Close(ctx, key)
+	})
+	for _, s := range c.sinks {
+		s.em.Lock()
+		delete(s.failed, key)
+		s.em.Unlock()
+	}
+	return err
+}
+
+// SinkErrors returns the last error of each sink that failed for
+// the key.
+func (c *multiClient) SinkErrors(key string) map[string]string {
+	var out map[string]string
+	for _, s := range c.sinks {
+		s.em.Lock()
+		if err := s.errs[key]; err != nil {
+			if out == nil {
+				out = map[string]string{}
+			}
+			out[s.Name] = err.Error()
+		}
+		s.em.Unlock()
+	}
+	return out
+}
+
+// call calls fn for each sink in parallel and waits for the calls
+// to complete, or for the sink timeout. It returns an error if fn
+// failed for every sink.
+func (c *multiClient) call(ctx context.Context, key string, last bool, fn func(context.Context, *sink) error) error {
+	results := make([]chan error, len(c.sinks))
+	for i, s := range c.sinks {
+		s := s
+		// the result of the call and of the timeout are both
+		// sent, the first one is used.
+		result := make(chan error, 2) // nolint:gomnd
+		results[i] = result
+		ctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+		go func() {
+			<-ctx.Done()
+			result <- fmt.Errorf("sink did not complete: %w", ctx.Err())
+		}()
+		// the call is queued in the background, so that a sink
+		// whose queue is full does not hold back the others.
+		go func() {
+			queued := s.enqueue(ctx, key, true, last, func() {
+				defer cancel()
+				result <- fn(ctx, s)
+			})
+			if !queued {
+				cancel()
+			}
+		}()
+	}
+
+	var result error
+	succeeded := false
+	for i, s := range c.sinks {
+		err := <-results[i]
+		if err == nil {
+			succeeded = true
+			continue
+		}
+		logrus.WithError(err).WithField("key", key).WithField("sink", s.Name).
+			Errorln("log sink failed")
+		s.setErr(key, err)
+		result = multierror.Append(result, fmt.Errorf("%s: %w", s.Name, err))
+	}
+	if succeeded {
+		return nil
+	}
+	if result == nil {
+		return errors.New("no log sinks configured")
+	}
+	return result
+}
+
+// keyQueue is the queue of the calls of a key to a sink, which are
+// called in order by a goroutine of their own.
+type keyQueue struct {
+	mu     sync.RWMutex // held for reading while calls are sent
+	calls  chan func()
+	closed bool
+}
+
+// enqueue queues fn to be called after the calls queued before for
+// the key. If the queue is full, fn is dropped and enqueue returns
+// false if block is false, or once the context is done. Calls that
+// do not block are ignored if the key has no queue, eg it is already
+// closed. If last is true the queue of the key is removed once fn is
+// called.
+func (s *sink) enqueue(ctx context.Context, key string, block, last bool, fn func()) bool {
+	for {
+		s.mu.Lock()
+		queue, ok := s.queues[key]
+		if !ok && !block {
+			s.mu.Unlock()
+			return true
+		}
+		if !ok {
+			queue = &keyQueue{calls: make(chan func(), sinkQueueSize)}
+			s.queues[key] = queue
+			go func() {
+				for fn := range queue.calls {
+					fn()
+				}
+			}()
+		}
+		if last {
+			// the next calls of the key use a new queue.
+			delete(s.queues, key)
+		}
+		s.mu.Unlock()
+
+		// the calls are sent outside of s.mu, so that a full
+		// queue does not block the calls of the other keys.
+		if last {
+			queue.mu.Lock()
+		} else {
+			queue.mu.RLock()
+		}
+		if queue.closed {
+			// the queue was closed by the last call after it was
+			// looked up, the next calls use a new queue.
+			queue.mu.RUnlock()
+			if !block {
+				return true
+			}
+			continue
+		}
+		queued := true
+		switch {
+		case ctx.Err() != nil:
+			queued = false
+		case block:
+			select {
+			case queue.calls <- fn:
+			case <-ctx.Done():
+				queued = false
+			}
+		default:
+			select {
+			case queue.calls <- fn:
+			default:
+				queued = false
+			}
+		}
+		if last {
+			queue.closed = true
+			close(queue.calls)
+			queue.mu.Unlock()
+		} else {
+			queue.mu.RUnlock()
+		}
+		return queued
+	}
+}
+
+func (s *sink) setErr(key string, err error) {
+	s.em.Lock()
+	s.errs[key] = err
+	s.em.Unlock()
+}
+
+// SinkErrors returns the last error of each sink of the client that
+// failed for the key, or nil if the client does not write to sinks.
+func SinkErrors(client Client, key string) map[string]string {
+	if c, ok := client.(interface {
+		SinkErrors(key string) map[string]string
+	}); ok {
+		return c.SinkErrors(key)
+	}
+	return nil
+}
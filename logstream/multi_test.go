@@ -0,0 +1,146 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sinkClient struct {
+	mu       sync.Mutex
+	err      error
+	block    chan struct{}
+	written  int
+	uploaded int
+}
+
+func (c *sinkClient) Open(context.Context, string) error  { return c.err }
+func (c *sinkClient) Close(context.Context, string) error { return nil }
+
+func (c *sinkClient) Write(_ context.Context, _ string, lines []*Line) error {
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	c.written += len(lines)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *sinkClient) Upload(_ context.Context, _ string, lines []*Line) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.mu.Lock()
+	c.uploaded += len(lines)
+	c.mu.Unlock()
+	return nil
+}
+
+func TestMultiClient(t *testing.T) {
+	ok := new(sinkClient)
+	slow := &sinkClient{block: make(chan struct{})}
+	failing := &sinkClient{err: errors.New("unavailable")}
+	c := NewMultiClient(Sink{"ok", ok}, Sink{"slow", slow}, Sink{"failing", failing})
+	ctx := context.Background()
+
+	if err := c.Open(ctx, "key"); err != nil {
+		t.Fatalf("Want open to succeed if a sink succeeds, got %s", err)
+	}
+
+	// writes are not held back by the slow sink.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < sinkQueueSize*2; i++ {
+			c.Write(ctx, "key", []*Line{{Message: "line\n"}}) // nolint:errcheck
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Writes blocked by the slow sink")
+	}
+	close(slow.block)
+
+	if err := c.Upload(ctx, "key", []*Line{{Message: "line\n"}}); err != nil {
+		t.Fatalf("Want upload to succeed if a sink succeeds, got %s", err)
+	}
+	if err := c.Close(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes queued before the upload are completed, the
+	// writes the slow sink did not keep up with are dropped.
+	if slow.written < sinkQueueSize || slow.written >= sinkQueueSize*2 {
+		t.Errorf("Want the slow sink to drop writes, got %d writes", slow.written)
+	}
+	if ok.uploaded != 1 || slow.uploaded != 1 {
+		t.Errorf("Unexpected uploads %d, %d", ok.uploaded, slow.uploaded)
+	}
+	errs := SinkErrors(c, "key")
+	if errs["failing"] != "unavailable" || errs["slow"] == "" {
+		t.Errorf("Unexpected sink errors %v", errs)
+	}
+
+	c = NewMultiClient(Sink{"failing", failing})
+	if err := c.Upload(ctx, "key", nil); err == nil {
+		t.Errorf("Want error if every sink fails")
+	}
+}
+
+func TestMultiClientHungSink(t *testing.T) {
+	defer func(timeout time.Duration) { sinkTimeout = timeout }(sinkTimeout)
+	sinkTimeout = 50 * time.Millisecond
+
+	ok := new(sinkClient)
+	hung := &sinkClient{block: make(chan struct{})}
+	defer close(hung.block)
+	c := NewMultiClient(Sink{"ok", ok}, Sink{"hung", hung})
+	ctx := context.Background()
+
+	if err := c.Open(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	// the hung sink blocks on the first write, the next ones fill
+	// its queue.
+	for i := 0; i < sinkQueueSize+2; i++ {
+		c.Write(ctx, "key", []*Line{{Message: "line\n"}}) // nolint:errcheck
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the calls of the other keys are not held back.
+		if err := c.Open(ctx, "other"); err != nil {
+			t.Error(err)
+		}
+		if err := c.Upload(ctx, "key", []*Line{{Message: "line\n"}}); err != nil {
+			t.Errorf("Want upload to succeed if a sink succeeds, got %s", err)
+		}
+		c.Close(ctx, "key") // nolint:errcheck
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Calls blocked by the hung sink")
+	}
+	if errs := SinkErrors(c, "key"); errs["hung"] == "" {
+		t.Errorf("Want the hung sink to time out, got %v", errs)
+	}
+
+	// the writes of a closed key are ignored.
+	c.Write(ctx, "key", []*Line{{Message: "line\n"}}) // nolint:errcheck
+	s := c.(*multiClient).sinks[1]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.queues["key"]; ok || len(s.queues) != 1 {
+		t.Errorf("Want no queue for the closed key, got %d queues", len(s.queues))
+	}
+}
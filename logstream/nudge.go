@@ -4,6 +4,23 @@
 
 package logstream
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Severities of a nudge.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
 // Nudge is an interface which provides a resolution (nudge)
 // if a specific term is found.
 type Nudge interface {
@@ -16,20 +33,115 @@ type Nudge interface {
 	// GetResolution returns the resolution in case
 	// the search term is encountered
 	GetResolution() string
+
+	// GetSeverity returns the severity of the nudge
+	GetSeverity() string
+
+	// GetWindow returns the number of lines at the end of the
+	// log the search term is looked for in. Zero means the
+	// full log is searched.
+	GetWindow() int
+
+	// Match returns true if the line contains the search term
+	Match(line string) bool
 }
 
 func NewNudge(search, resolution string, err error) Nudge {
+	return newNudge(search, resolution, err, SeverityError, 0)
+}
+
+func newNudge(search, resolution string, err error, severity string, window int) *nudge {
+	r, cerr := regexp.Compile(search)
+	if cerr != nil {
+		logrus.WithError(cerr).WithField("search", search).Errorln("error while compiling regex")
+	}
 	return &nudge{
 		search:     search,
 		resolution: resolution,
 		error:      err,
+		severity:   severity,
+		window:     window,
+		regexp:     r,
 	}
 }
 
+// NudgeRule describes a nudge loaded from a file.
+type NudgeRule struct {
+	Search     string `yaml:"search"`
+	Error      string `yaml:"error,omitempty"` // defaults to the search term
+	Resolution string `yaml:"resolution"`
+	Severity   string `yaml:"severity,omitempty"` // error, warning or info. Defaults to error
+	Window     int    `yaml:"window,omitempty"`   // lines at the end of the log searched. Defaults to the full log
+}
+
+// NewNudgeFromRule returns the nudge of the rule.
+func NewNudgeFromRule(rule NudgeRule) (Nudge, error) {
+	if _, err := regexp.Compile(rule.Search); err != nil {
+		return nil, fmt.Errorf("nudge %q: %w", rule.Search, err)
+	}
+	severity := rule.Severity
+	switch severity {
+	case "":
+		severity = SeverityError
+	case SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		return nil, fmt.Errorf("nudge %q: unknown severity %q", rule.Search, severity)
+	}
+	if rule.Window < 0 {
+		return nil, fmt.Errorf("nudge %q: negative window", rule.Search)
+	}
+	// the error is reported as the step error, which must not be
+	// empty.
+	msg := rule.Error
+	if msg == "" {
+		msg = fmt.Sprintf("found %q in the logs", rule.Search)
+	}
+	return newNudge(rule.Search, rule.Resolution, errors.New(msg), severity, rule.Window), nil
+}
+
+// LoadNudges loads the nudges from a yaml file. The nudges of the
+// file are added to the defaults, unless the file disables them.
+//
+//	disable_defaults: false
+//	nudges:
+//	- search: 'No space left on device'
+//	  error: out of disk space
+//	  resolution: Increase the disk size of the runner
+//	  severity: error
+//	  window: 10
+func LoadNudges(path string, defaults []Nudge) ([]Nudge, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := new(struct {
+		DisableDefaults bool        `yaml:"disable_defaults"`
+		Nudges          []NudgeRule `yaml:"nudges"`
+	})
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, err
+	}
+	var nudges []Nudge
+	if !file.DisableDefaults {
+		nudges = append(nudges, defaults...)
+	}
+	for _, rule := range file.Nudges {
+		n, err := NewNudgeFromRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		nudges = append(nudges, n)
+	}
+	return nudges, nil
+}
+
 type nudge struct {
 	search     string
 	resolution string
 	error      error
+	severity   string
+	window     int
+	regexp     *regexp.Regexp
 }
 
 func (n *nudge) GetSearch() string {
@@ -43,3 +155,15 @@ func (n *nudge) GetResolution() string {
 func (n *nudge) GetError() error {
 	return n.error
 }
+
+func (n *nudge) GetSeverity() string {
+	return n.severity
+}
+
+func (n *nudge) GetWindow() int {
+	return n.window
+}
+
+func (n *nudge) Match(line string) bool {
+	return n.regexp != nil && n.regexp.MatchString(line)
+}
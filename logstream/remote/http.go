@@ -69,25 +69,23 @@ type HTTPClient struct {
 	AccountID      string
 	SkipVerify     bool
 	IndirectUpload bool
+
+	// Compress enables the gzip compression of uploads, for the
+	// endpoints that accept gzip encoded requests.
+	Compress bool
+
+	// gzipRejected is set once an endpoint rejected a compressed
+	// upload, after which uploads are no longer compressed.
+	gzipRejected int32
 }
 
 // UploadFile uploads the file directly to data store or via log service
 // if indirectUpload is true, logs go through log service instead of using an uploadable link.
 func (c *HTTPClient) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
-	data := new(bytes.Buffer)
-	for _, line := range convertLines(lines) {
-		buf := new(bytes.Buffer)
-		if err := json.NewEncoder(buf).Encode(line); err != nil {
-			logrus.WithError(err).WithField("key", key).
-				Errorln("failed to encode line")
-			return err
-		}
-		data.Write(buf.Bytes())
-	}
 	if c.IndirectUpload {
 		logrus.WithField("key", key).
 			Infoln("uploading logs through log service as indirectUpload is specified as true")
-		err := c.uploadToRemoteStorage(ctx, key, data)
+		err := c.uploadToRemoteStorage(ctx, key, lines)
 		if err != nil {
 			logrus.WithError(err).WithField("key", key).
 				Errorln("failed to upload logs through log service")
@@ -103,7 +101,7 @@ func (c *HTTPClient) Upload(ctx context.Context, key string, lines []*logstream.
 		}
 
 		logrus.WithField("key", key).Infoln("uploading logs using link")
-		err = c.uploadUsingLink(context.Background(), link.Value, data)
+		err = c.uploadUsingLink(context.Background(), link.Value, lines)
 		if err != nil {
 			logrus.WithError(err).WithField("key", key).
 				Errorln("failed to upload using link")
@@ -113,15 +111,12 @@ func (c *HTTPClient) Upload(ctx context.Context, key string, lines []*logstream.
 	return nil
 }
 
-// uploadToRemoteStorage uploads the file to remote storage.
-func (c *HTTPClient) uploadToRemoteStorage(ctx context.Context, key string, r io.Reader) error {
+// uploadToRemoteStorage uploads the file to remote storage. The
+// lines are streamed to the log service as they are encoded.
+func (c *HTTPClient) uploadToRemoteStorage(ctx context.Context, key string, lines []*logstream.Line) error {
 	path := fmt.Sprintf(blobEndpoint, c.AccountID, key)
 	backoff := createInfiniteBackoff()
-	resp, err := c.retry(ctx, c.Endpoint+path, "POST", r, nil, true, backoff)
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	return err
+	return c.uploadLines(ctx, "POST", c.Endpoint+path, lines, true, backoff)
 }
 
 // uploadLink returns a secure link that can be used to
@@ -134,12 +129,12 @@ func (c *HTTPClient) uploadLink(ctx context.Context, key string) (*Link, error)
 	return out, err
 }
 
-// uploadUsingLink takes in a reader and a link object and uploads directly to
-// remote storage.
-func (c *HTTPClient) uploadUsingLink(ctx context.Context, link string, r io.Reader) error {
-	backoff := createBackoff(60 * time.Second)                 // nolint:gomnd
-	_, err := c.retry(ctx, link, "PUT", r, nil, true, backoff) // nolint:bodyclose
-	return err
+// uploadUsingLink uploads the lines directly to remote storage
+// using the link. Object stores require the length of the upload
+// to be known, so the encoded lines are buffered.
+func (c *HTTPClient) uploadUsingLink(ctx context.Context, link string, lines []*logstream.Line) error {
+	backoff := createBackoff(60 * time.Second) // nolint:gomnd
+	return c.uploadLines(ctx, "PUT", link, lines, false, backoff)
 }
 
 // Open opens the data stream.
@@ -315,12 +310,14 @@ func createBackoff(maxElapsedTime time.Duration) *backoff.ExponentialBackOff {
 func convertLines(lines []*logstream.Line) []*Line {
 	var res []*Line
 	for _, l := range lines {
-		res = append(res, &Line{
+		line := &Line{
 			Level:     l.Level,
 			Message:   l.Message,
 			Number:    l.Number,
 			Timestamp: l.Timestamp,
-		})
+			Args:      l.Fields(),
+		}
+		res = append(res, line)
 	}
 	return res
 }
@@ -0,0 +1,130 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+// uploadLines uploads the lines as newline delimited json, gzip
+// compressed if enabled, unless the endpoint rejected compressed
+// uploads. If
+// stream is true the lines are encoded while the request is sent,
+// otherwise they are encoded into a buffer first. The lines are
+// encoded again for each attempt.
+func (c *HTTPClient) uploadLines(ctx context.Context, method, url string, lines []*logstream.Line, stream bool, b backoff.BackOff) error {
+	compress := c.Compress && atomic.LoadInt32(&c.gzipRejected) == 0
+	for {
+		code, err := c.sendLines(ctx, method, url, lines, compress, stream)
+
+		// do not retry on Canceled or DeadlineExceeded
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		if compress && rejectsCompression(code) {
+			logrus.WithError(err).WithField("status", code).
+				Warnln("http: endpoint rejected the compressed upload, uploading uncompressed")
+			atomic.StoreInt32(&c.gzipRejected, 1)
+			compress = false
+			continue
+		}
+		// retry on request errors and 5xx-range responses.
+		if code != 0 && code < 500 { // nolint:gomnd
+			return err
+		}
+
+		duration := b.NextBackOff()
+		if duration == backoff.Stop {
+			return err
+		}
+		logrus.WithError(err).Warnln("http: upload failed. Retrying ...")
+		time.Sleep(duration)
+	}
+}
+
+// sendLines sends a single upload request and returns the status
+// code of the response, or zero if the request failed.
+func (c *HTTPClient) sendLines(ctx context.Context, method, url string, lines []*logstream.Line, compress, stream bool) (int, error) {
+	var body io.Reader
+	var length int64
+	if stream {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			pw.CloseWithError(encodeLines(pw, lines, compress))
+		}()
+		body, length = pr, -1
+	} else {
+		buf := new(bytes.Buffer)
+		if err := encodeLines(buf, lines, compress); err != nil {
+			return 0, err
+		}
+		body, length = buf, int64(buf.Len())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = length
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Add("X-Harness-Token", c.Token)
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 300 { // nolint:gomnd
+		return res.StatusCode, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096)) // nolint:gomnd
+	if len(msg) == 0 {
+		return res.StatusCode, &Error{Code: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+	}
+	return res.StatusCode, &Error{Code: res.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
+
+// helper function returns true if the status code indicates the
+// endpoint does not accept gzip encoded uploads. Other client errors,
+// eg an expired upload link, are not caused by the compression.
+func rejectsCompression(code int) bool {
+	return code == http.StatusUnsupportedMediaType
+}
+
+// encodeLines writes the lines as newline delimited json.
+func encodeLines(w io.Writer, lines []*logstream.Line, compress bool) error {
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	enc := json.NewEncoder(w)
+	for _, line := range convertLines(lines) {
+		if err := enc.Encode(line); err != nil {
+			logrus.WithError(err).Errorln("failed to encode line")
+			return err
+		}
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+func TestUploadCompressed(t *testing.T) {
+	var encoding string
+	var got []*Line
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		got = readLines(t, r)
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, "account", "token", true, false)
+	c.Compress = true
+	lines := []*logstream.Line{{Number: 0, Message: "hello\n"}, {Number: 1, Message: "world\n"}}
+	if err := c.Upload(context.Background(), "key", lines); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "gzip" {
+		t.Errorf("Want gzip encoded upload, got %q", encoding)
+	}
+	if len(got) != 2 || got[0].Message != "hello\n" || got[1].Message != "world\n" {
+		t.Errorf("Unexpected lines %+v", got)
+	}
+}
+
+func TestUploadCompressionFallback(t *testing.T) {
+	var requests []string
+	var got []*Line
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Content-Encoding"))
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		got = readLines(t, r)
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, "account", "token", true, false)
+	c.Compress = true
+	lines := []*logstream.Line{{Number: 0, Message: "hello\n"}}
+	for i := 0; i < 2; i++ {
+		if err := c.Upload(context.Background(), "key", lines); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the second upload should not attempt compression again.
+	if len(requests) != 3 || requests[0] != "gzip" || requests[1] != "" || requests[2] != "" {
+		t.Errorf("Unexpected requests %q", requests)
+	}
+	if len(got) != 1 || got[0].Message != "hello\n" {
+		t.Errorf("Unexpected lines %+v", got)
+	}
+}
+
+func TestUploadUncompressed(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Content-Encoding"))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	// the uploads are not compressed unless enabled.
+	c := NewHTTPClient(srv.URL, "account", "token", true, false)
+	lines := []*logstream.Line{{Number: 0, Message: "hello\n"}}
+	if err := c.Upload(context.Background(), "key", lines); err == nil {
+		t.Errorf("Want forbidden error")
+	}
+	// a forbidden compressed upload is not retried uncompressed.
+	c.Compress = true
+	if err := c.Upload(context.Background(), "key", lines); err == nil {
+		t.Errorf("Want forbidden error")
+	}
+	if len(requests) != 2 || requests[0] != "" || requests[1] != "gzip" {
+		t.Errorf("Unexpected requests %q", requests)
+	}
+}
+
+func readLines(t *testing.T, r *http.Request) []*Line {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		body = zr
+	}
+	var lines []*Line
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := new(Line)
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			t.Error(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -5,22 +5,75 @@
 package logstream
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	maskedStr = "**************"
+
+	// minimum length of an encoded form of a secret that is
+	// masked. Shorter forms are likely to match unrelated output.
+	minEncodedLen = 6
+
+	// minimum length of the base64 encoded form of a secret at an
+	// offset, which is a substring of the encoded value and more
+	// likely to match unrelated output.
+	minOffsetEncodedLen = 8
+
+	// maximum size of the incomplete line of a stream held back
+	// when credential rules are set. Longer lines are masked and
+	// written, except for the last heldLineOverlap bytes, which are
+	// longer than the credentials matched by the rules.
+	maxHeldLine     = 16 * 1024
+	heldLineOverlap = 1024
 )
 
-// replacer wraps a stream writer with a replacer
+// replacer wraps a stream writer with a replacer. Output that may
+// be the start of a secret is held back until the rest of the
+// output is written, so that secrets split across writes are
+// masked. If credential rules are set, output is held back until
+// the line is complete, or until the line exceeds maxHeldLine.
 type replacer struct {
 	w Writer
-	r *strings.Replacer
+
+	// secrets indexed by their first byte, longest first.
+	secrets map[byte][]string
+	rules   *Rules
+
+	mu       sync.Mutex
+	held     map[string][]byte     // output of each stream held back
+	heldTime map[string]time.Time  // time the held back output was produced
+	state    map[string]*ruleState // state of the rules of each stream
+	masked   int                   // number of masked occurrences
 }
 
-// NewReplacer returns a replacer that wraps io.Writer w.
+// NewReplacer returns a replacer that wraps io.Writer w. The common
+// encodings of each secret, base64, url and json escaped, are masked
+// as well.
 func NewReplacer(w Writer, secrets []string) Writer {
-	var oldnew []string
+	return NewReplacerWithRules(w, secrets, nil)
+}
+
+// NewReplacerWithRules returns a replacer that wraps io.Writer w and
+// masks the credentials matched by the rules in addition to the
+// secrets.
+func NewReplacerWithRules(w Writer, secrets []string, rules *Rules) Writer {
+	seen := map[string]bool{}
+	index := map[byte][]string{}
+	add := func(s string) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		index[s[0]] = append(index[s[0]], s)
+	}
 	for _, secret := range secrets {
 		if secret == "" {
 			continue
@@ -35,25 +88,219 @@ func NewReplacer(w Writer, secrets []string) Writer {
 				continue
 			}
 
-			oldnew = append(oldnew, part, maskedStr)
+			add(part)
+			for _, enc := range encodings(part) {
+				if len(enc) >= minEncodedLen {
+					add(enc)
+				}
+			}
+		}
+		// multiline secrets are escaped as a whole in json.
+		if strings.Contains(strings.TrimSpace(secret), "\n") {
+			for _, enc := range encodings(strings.TrimSpace(secret)) {
+				if len(enc) >= minEncodedLen && !strings.Contains(enc, "\n") {
+					add(enc)
+				}
+			}
 		}
 	}
-	if len(oldnew) == 0 {
+	if len(index) == 0 && (rules == nil || len(rules.rules) == 0) {
 		return w
 	}
+	for _, v := range index {
+		sort.SliceStable(v, func(i, j int) bool {
+			return len(v[i]) > len(v[j])
+		})
+	}
 	return &replacer{
-		w: w,
-		r: strings.NewReplacer(oldnew...),
+		w:        w,
+		secrets:  index,
+		rules:    rules,
+		held:     map[string][]byte{},
+		heldTime: map[string]time.Time{},
+		state:    map[string]*ruleState{},
 	}
 }
 
 // Write writes p to the base writer. The method scans for any
 // sensitive data in p and masks before writing.
 func (r *replacer) Write(p []byte) (n int, err error) {
-	_, err = r.w.Write([]byte(r.r.Replace(string(p))))
+	return r.WriteStream("", time.Time{}, p)
+}
+
+// WriteStream writes p to the stream of the base writer, masking
+// any sensitive data.
+func (r *replacer) WriteStream(stream string, ts time.Time, p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	// the output is written with the time the held back output
+	// was produced.
+	start := ts
+	if len(r.held[stream]) > 0 {
+		start = r.heldTime[stream]
+	}
+
+	var out, rest []byte
+	if buf := append(r.held[stream], p...); r.rules != nil {
+		i := bytes.LastIndexByte(buf, '\n') + 1
+		if len(buf)-i > maxHeldLine {
+			i += r.cutLine(buf[i:])
+		}
+		out, rest = r.maskLines(stream, buf[:i]), buf[i:]
+	} else {
+		out, rest = r.mask(buf, false)
+	}
+	r.held[stream] = append([]byte(nil), rest...)
+	switch {
+	case len(rest) == 0:
+		delete(r.heldTime, stream)
+	case len(out) == 0:
+		r.heldTime[stream] = start
+	default:
+		r.heldTime[stream] = ts
+	}
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	_, err = WriteStream(r.w, stream, start, out)
 	return len(p), err
 }
 
+// mask returns buf with the secrets masked. Unless final is true,
+// output at the end of buf that may be the start of a secret is
+// not masked but returned as rest.
+func (r *replacer) mask(buf []byte, final bool) (out, rest []byte) {
+	var b bytes.Buffer
+	for i := 0; i < len(buf); {
+		matched, partial := r.match(buf[i:])
+		if matched > 0 {
+			r.masked++
+			b.WriteString(maskedStr)
+			i += matched
+			continue
+		}
+		if partial && !final {
+			return b.Bytes(), buf[i:]
+		}
+		b.WriteByte(buf[i])
+		i++
+	}
+	return b.Bytes(), nil
+}
+
+// maskLines returns the lines with the secrets and the credentials
+// matched by the rules masked.
+func (r *replacer) maskLines(stream string, p []byte) []byte {
+	out, _ := r.mask(p, true)
+	if r.rules == nil || len(out) == 0 {
+		return out
+	}
+	state := r.state[stream]
+	if state == nil {
+		state = new(ruleState)
+		r.state[stream] = state
+	}
+	var b bytes.Buffer
+	for _, line := range strings.SplitAfter(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		line, n := r.rules.mask(state, line)
+		r.masked += n
+		b.WriteString(line)
+	}
+	return b.Bytes()
+}
+
+// cutLine returns the length of the start of the incomplete line
+// that is masked and written. The line is cut before the overlap
+// held back, at a white space if any, and before any secret or
+// credential that would be split.
+func (r *replacer) cutLine(line []byte) int {
+	cut := len(line) - heldLineOverlap
+	if i := bytes.LastIndexAny(line[cut-heldLineOverlap:cut], " \t\r"); i >= 0 {
+		cut -= heldLineOverlap - i - 1
+	}
+	start := cut - heldLineOverlap
+	split := cut
+	for i := start; i < cut; i++ {
+		if n, _ := r.match(line[i:]); n > 0 && i+n > cut && i < split {
+			split = i
+		}
+	}
+	for _, rule := range r.rules.rules {
+		for _, loc := range rule.pattern.FindAllIndex(line[start:], -1) {
+			if start+loc[0] < cut && start+loc[1] > cut && start+loc[0] < split {
+				split = start + loc[0]
+			}
+		}
+	}
+	return split
+}
+
+// match returns the length of the longest secret p starts with. If
+// p does not start with a secret, partial reports whether p is the
+// start of a secret.
+func (r *replacer) match(p []byte) (n int, partial bool) {
+	for _, secret := range r.secrets[p[0]] {
+		if len(p) >= len(secret) {
+			if string(p[:len(secret)]) == secret {
+				return len(secret), false
+			}
+		} else if strings.HasPrefix(secret, string(p)) {
+			partial = true
+		}
+	}
+	return 0, partial
+}
+
+// flush writes the output held back, masking any sensitive data.
+func (r *replacer) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	streams := make([]string, 0, len(r.held))
+	for stream := range r.held {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	var err error
+	for _, stream := range streams {
+		out := r.maskLines(stream, r.held[stream])
+		if len(out) == 0 {
+			continue
+		}
+		if _, werr := WriteStream(r.w, stream, r.heldTime[stream], out); werr != nil {
+			err = werr
+		}
+	}
+	r.held = map[string][]byte{}
+	r.heldTime = map[string]time.Time{}
+	return err
+}
+
+// Masked returns the number of masked occurrences of secrets and
+// credentials.
+func (r *replacer) Masked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.masked
+}
+
+// Masked returns the number of occurrences of secrets masked by w,
+// or zero if w does not mask secrets.
+func Masked(w Writer) int {
+	if m, ok := w.(interface{ Masked() int }); ok {
+		return m.Masked()
+	}
+	return 0
+}
+
 // Open opens the base writer.
 func (r *replacer) Open() error {
 	return r.w.Open()
@@ -63,11 +310,63 @@ func (r *replacer) Start() {
 	r.w.Start()
 }
 
-// Close closes the base writer.
+// Close flushes the output held back and closes the base writer.
 func (r *replacer) Close() error {
+	r.flush() // nolint:errcheck
 	return r.w.Close()
 }
 
 func (r *replacer) Error() error {
 	return r.w.Error()
 }
+
+// encodings returns the common encodings of the secret that may
+// appear in the output.
+func encodings(secret string) []string {
+	v := []string{
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+	}
+
+	// json escaped, with and without escaping html characters.
+	if b, err := json.Marshal(secret); err == nil {
+		v = append(v, string(b[1:len(b)-1]))
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(secret); err == nil {
+		s := strings.TrimSuffix(b.String(), "\n")
+		v = append(v, s[1:len(s)-1])
+	}
+
+	// base64 encoded. The secret may be encoded as part of a
+	// larger value, e.g. basic auth credentials, in which case
+	// its encoding depends on its offset within the value. Only
+	// the characters that are determined by the secret alone
+	// are masked.
+	for offset := 0; offset < 3; offset++ {
+		data := append(make([]byte, offset), secret...)
+		start := (offset*8 + 5) / 6 // nolint:gomnd
+		end := (len(data) * 8) / 6  // nolint:gomnd
+		if end-start < minOffsetEncodedLen {
+			continue
+		}
+		for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+			s := encoding.EncodeToString(data)
+			v = append(v, s[start:end])
+		}
+	}
+	v = append(v,
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.URLEncoding.EncodeToString([]byte(secret)),
+	)
+
+	var out []string
+	for _, s := range v {
+		if s != secret && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
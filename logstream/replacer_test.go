@@ -5,6 +5,9 @@
 package logstream
 
 import (
+	"encoding/base64"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -69,6 +72,73 @@ func TestReplaceMultilineJson(t *testing.T) {
 	}
 }
 
+func TestReplaceSplitWrites(t *testing.T) {
+	secrets := []string{"correct-horse-batter-staple"}
+
+	sw := &nopWriter{}
+	w := NewReplacer(&nopCloser{sw}, secrets)
+	w.Write([]byte("password corr"))     // nolint:errcheck
+	w.Write([]byte("ect-horse-"))        // nolint:errcheck
+	w.Write([]byte("batter-staple\n"))   // nolint:errcheck
+	w.Write([]byte("the end is corr\n")) // nolint:errcheck
+	w.Close()
+
+	if got, want := strings.Join(sw.data, ""), "password **************\nthe end is corr\n"; got != want {
+		t.Errorf("Want masked string %q, got %q", want, got)
+	}
+	// output that cannot be the start of a secret is not held back.
+	if got, want := sw.data[0], "password "; got != want {
+		t.Errorf("Want %q written immediately, got %q", want, got)
+	}
+}
+
+func TestReplaceEncodings(t *testing.T) {
+	secret := "p@ss/w0rd&\"token\""
+	tests := []string{
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.URLEncoding.EncodeToString([]byte(secret)),
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+		`p@ss/w0rd&\"token\"`,
+		`p@ss/w0rd\u0026\"token\"`,
+	}
+	for _, test := range tests {
+		sw := &nopWriter{}
+		w := NewReplacer(&nopCloser{sw}, []string{secret})
+		w.Write([]byte("value " + test + "\n")) // nolint:errcheck
+		w.Close()
+
+		if got := strings.Join(sw.data, ""); strings.Contains(got, test) || !strings.Contains(got, maskedStr) {
+			t.Errorf("Want encoded secret %q masked, got %q", test, got)
+		}
+	}
+}
+
+func TestReplaceBase64Offset(t *testing.T) {
+	secret := "correct-horse-batter-staple"
+	for _, user := range []string{"a", "ab", "abc"} {
+		encoded := base64.StdEncoding.EncodeToString([]byte(user + ":" + secret))
+
+		sw := &nopWriter{}
+		w := NewReplacer(&nopCloser{sw}, []string{secret})
+		w.Write([]byte("Authorization: Basic " + encoded + "\n")) // nolint:errcheck
+		w.Close()
+
+		if got := strings.Join(sw.data, ""); strings.Contains(got, encoded) || !strings.Contains(got, maskedStr) {
+			t.Errorf("Want credentials of user %s masked, got %q", user, got)
+		}
+	}
+}
+
+func TestReplaceShortBase64Offset(t *testing.T) {
+	// the offset encodings of short secrets match unrelated output.
+	for _, enc := range encodings("hunter") {
+		if len(enc) < minOffsetEncodedLen {
+			t.Errorf("Want no encoding shorter than %d, got %q", minOffsetEncodedLen, enc)
+		}
+	}
+}
+
 type nopCloser struct {
 	Writer
 }
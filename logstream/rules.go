@@ -0,0 +1,170 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maximum number of lines masked by a block rule. If the end of
+// the block is not found within these lines masking stops, so that
+// a missing end does not mask the remainder of the logs.
+const maxBlockLines = 256
+
+// Rule describes a credential pattern that is masked in the logs.
+type Rule struct {
+	ID string `yaml:"id"`
+
+	// Pattern is the regular expression that matches the
+	// credential.
+	Pattern string `yaml:"pattern"`
+
+	// End is the regular expression that matches the end of a
+	// credential that spans multiple lines, e.g. a private key
+	// block. If set, everything from the start of the Pattern
+	// match to the end of the End match is masked.
+	End string `yaml:"end,omitempty"`
+}
+
+// defaultRules match credentials with a format that is distinctive
+// enough to be masked without false positives.
+var defaultRules = []Rule{
+	{ID: "aws-access-key-id", Pattern: `\b(?:A3T[A-Z0-9]|AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[A-Z0-9]{16}\b`},
+	{ID: "gcp-api-key", Pattern: `\bAIza[0-9A-Za-z_\-]{35}\b`},
+	{ID: "github-token", Pattern: `\bgh[pousr]_[A-Za-z0-9]{36,255}\b`},
+	{ID: "github-fine-grained-token", Pattern: `\bgithub_pat_[A-Za-z0-9_]{82}\b`},
+	{ID: "gitlab-token", Pattern: `\bgl(?:pat|dt|ptt|rt)-[A-Za-z0-9_\-]{20,}\b`},
+	{ID: "slack-token", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}\b`},
+	{ID: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`},
+	{ID: "private-key", Pattern: `-----BEGIN[A-Z ]*PRIVATE KEY(?: BLOCK)?-----`, End: `-----END[A-Z ]*PRIVATE KEY(?: BLOCK)?-----`},
+}
+
+// Rules is a compiled set of credential rules.
+type Rules struct {
+	rules []*rule
+}
+
+type rule struct {
+	id      string
+	pattern *regexp.Regexp
+	end     *regexp.Regexp
+}
+
+// DefaultRules returns the built-in credential rules.
+func DefaultRules() *Rules {
+	rules, err := CompileRules(defaultRules)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// CompileRules compiles the credential rules.
+func CompileRules(rules []Rule) (*Rules, error) {
+	out := new(Rules)
+	for _, r := range rules {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		c := &rule{id: r.ID, pattern: pattern}
+		if r.End != "" {
+			if c.end, err = regexp.Compile(r.End); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+		}
+		out.rules = append(out.rules, c)
+	}
+	return out, nil
+}
+
+// LoadRules loads the credential rules from a yaml file. The rules
+// of the file are added to the built-in rules, unless the file
+// disables them.
+//
+//	disable_defaults: false
+//	rules:
+//	- id: internal-token
+//	  pattern: '\bitk_[a-z0-9]{32}\b'
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := new(struct {
+		DisableDefaults bool   `yaml:"disable_defaults"`
+		Rules           []Rule `yaml:"rules"`
+	})
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, err
+	}
+	rules := file.Rules
+	if !file.DisableDefaults {
+		rules = append(append([]Rule{}, defaultRules...), rules...)
+	}
+	return CompileRules(rules)
+}
+
+// ruleState is the state of the rules for a stream of lines.
+type ruleState struct {
+	block *rule // block rule whose end was not found yet
+	lines int   // number of lines masked by the block rule
+}
+
+// mask masks the credentials in the line and returns the number of
+// credentials masked. The line may end with a newline.
+func (r *Rules) mask(state *ruleState, line string) (string, int) {
+	eol := ""
+	if strings.HasSuffix(line, "\n") {
+		line, eol = strings.TrimSuffix(line, "\n"), "\n"
+	}
+
+	// mask the line if it is within a block.
+	if state.block != nil {
+		loc := state.block.end.FindStringIndex(line)
+		switch {
+		case loc != nil:
+			line = maskedStr + line[loc[1]:]
+			state.block = nil
+		case state.lines < maxBlockLines:
+			state.lines++
+			return maskedStr + eol, 0
+		default:
+			state.block = nil
+		}
+	}
+
+	n := 0
+	for _, rule := range r.rules {
+		if rule.end == nil {
+			line = rule.pattern.ReplaceAllStringFunc(line, func(string) string {
+				n++
+				return maskedStr
+			})
+			continue
+		}
+		for {
+			loc := rule.pattern.FindStringIndex(line)
+			if loc == nil {
+				break
+			}
+			n++
+			rest := line[loc[1]:]
+			end := rule.end.FindStringIndex(rest)
+			if end == nil {
+				// the block continues on the next lines.
+				state.block, state.lines = rule, 0
+				return line[:loc[0]] + maskedStr + eol, n
+			}
+			line = line[:loc[0]] + maskedStr + rest[end[1]:]
+		}
+	}
+	return line + eol, n
+}
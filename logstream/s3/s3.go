@@ -0,0 +1,267 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package s3 provides a log stream client that archives the logs in
+// an S3 compatible object store.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/logstream/remote"
+)
+
+const (
+	defaultRegion = "us-east-1"
+
+	// stagingSuffix is appended to the key of the objects the live
+	// lines are written to until the full history is uploaded.
+	stagingSuffix = ".staging"
+)
+
+// stagingInterval is the minimum time between two uploads of the
+// staging parts, so that the lines are batched in fewer objects.
+var stagingInterval = 5 * time.Second
+
+var _ logstream.Client = (*Client)(nil)
+
+// Config configures the object store the logs are archived in.
+type Config struct {
+	Endpoint        string // Example: https://s3.amazonaws.com or http://localhost:9000
+	Region          string
+	Bucket          string
+	Prefix          string // prefix of the object keys
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PathStyle       bool // address the bucket in the path instead of the host, as required by most S3 compatible stores
+}
+
+// Client archives the logs in an S3 compatible object store. The
+// live lines of a stream are written to staging parts, one object per
+// batch of lines, which are removed once the full history is uploaded.
+type Client struct {
+	Client *http.Client
+	config Config
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	now     func() time.Time
+}
+
+type stream struct {
+	buf    bytes.Buffer // encoded live lines not staged yet
+	staged time.Time    // time the last staging part was uploaded
+	parts  int          // number of staging parts uploaded
+}
+
+// New returns a new object store client.
+func New(config Config) *Client {
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &Client{
+		config:  config,
+		streams: map[string]*stream{},
+		now:     time.Now,
+	}
+}
+
+// Upload uploads the full log history to the object store.
+func (c *Client) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	data, err := encode(lines)
+	if err != nil {
+		return err
+	}
+	return c.put(ctx, c.objectKey(key), data)
+}
+
+// Open opens the data stream.
+func (c *Client) Open(ctx context.Context, key string) error {
+	c.mu.Lock()
+	c.streams[key] = new(stream)
+	c.mu.Unlock()
+	return nil
+}
+
+// Close closes the data stream and removes the staging parts.
+func (c *Client) Close(ctx context.Context, key string) error {
+	c.mu.Lock()
+	s, ok := c.streams[key]
+	delete(c.streams, key)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	for part := 0; part < s.parts; part++ {
+		if err := c.delete(ctx, c.stagingKey(key, part)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the lines to the staging parts of the stream. The
+// lines are buffered and uploaded as a new part at most once per
+// staging interval, so that each line is uploaded once.
+func (c *Client) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	data, err := encode(lines)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	s, ok := c.streams[key]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("stream %s is not opened", key)
+	}
+	s.buf.Write(data)
+	if c.now().Sub(s.staged) < stagingInterval {
+		c.mu.Unlock()
+		return nil
+	}
+	s.staged = c.now()
+	part := s.parts
+	s.parts++
+	staging := append([]byte(nil), s.buf.Bytes()...)
+	s.buf.Reset()
+	c.mu.Unlock()
+
+	// the lines of a part that failed to upload are not retried, as
+	// they are archived with the full history anyway.
+	return c.put(ctx, c.stagingKey(key, part), staging)
+}
+
+// helper function returns the object key of a staging part.
+func (c *Client) stagingKey(key string, part int) string {
+	return fmt.Sprintf("%s%s/%d", c.objectKey(key), stagingSuffix, part)
+}
+
+// helper function returns the object key of the log key.
+func (c *Client) objectKey(key string) string {
+	key = strings.TrimLeft(key, "/")
+	if c.config.Prefix == "" {
+		return key
+	}
+	return c.config.Prefix + "/" + key
+}
+
+// helper function returns the url of the object.
+func (c *Client) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(c.config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint %q", c.config.Endpoint)
+	}
+	if c.config.PathStyle {
+		u.Path += "/" + c.config.Bucket + "/" + key
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	return u, nil
+}
+
+func (c *Client) put(ctx context.Context, key string, data []byte) error {
+	res, err := c.do(ctx, http.MethodPut, key, data, map[string]string{"Content-Type": "application/x-ndjson"})
+	if err != nil {
+		return err
+	}
+	return checkResponse(res)
+}
+
+func (c *Client) delete(ctx context.Context, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	// the staging object does not exist if no lines were staged.
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkResponse(res)
+}
+
+// do sends a signed request for the object, draining and closing
+// the response body.
+func (c *Client) do(ctx context.Context, method, key string, data []byte, headers map[string]string) (*http.Response, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if c.config.AccessKeyID != "" {
+		sign(req, c.config.AccessKeyID, c.config.SecretAccessKey, c.config.SessionToken,
+			c.config.Region, hashHex(data), c.now())
+	}
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		logrus.WithError(err).WithField("key", key).Warnln("s3: request failed")
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096)) // nolint:gomnd
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+func (c *Client) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+// helper function returns an error if the response status is not
+// successful, including the error message of the object store.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode < 300 { // nolint:gomnd
+		return nil
+	}
+	body, _ := io.ReadAll(res.Body)
+	return &remote.Error{Code: res.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+// helper function encodes the lines as newline delimited json, in
+// the same format as the log service.
+func encode(lines []*logstream.Line) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, l := range lines {
+		line := &remote.Line{
+			Level:     l.Level,
+			Message:   l.Message,
+			Number:    l.Number,
+			Timestamp: l.Timestamp,
+			Args:      l.Fields(),
+		}
+		if err := enc.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package spool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+// spoolClient is a logstream.Client that spools the logs the
+// wrapped client fails to deliver.
+type spoolClient struct {
+	logstream.Client
+
+	spool  *Spool
+	target []byte
+
+	mu      sync.Mutex
+	pending map[string]bool // keys with live lines in the spool
+}
+
+// Write writes the lines to the live stream. If the lines cannot
+// be written they are spooled, and written ahead of the lines of
+// the next write.
+func (c *spoolClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending[key] {
+		spooled, err := c.spool.readPending(key)
+		if err != nil {
+			logrus.WithError(err).WithField("key", key).Errorln("spool: failed to read spooled lines")
+		} else if err := c.Client.Write(ctx, key, spooled); err != nil {
+			return c.appendPending(key, lines, err)
+		}
+		if err := c.spool.removePending(key); err != nil {
+			logrus.WithError(err).WithField("key", key).Errorln("spool: failed to remove spooled lines")
+		}
+		delete(c.pending, key)
+	}
+
+	if err := c.Client.Write(ctx, key, lines); err != nil {
+		return c.appendPending(key, lines, err)
+	}
+	return nil
+}
+
+func (c *spoolClient) appendPending(key string, lines []*logstream.Line, cause error) error {
+	if err := c.spool.appendPending(key, lines); err != nil {
+		logrus.WithError(err).WithField("key", key).Errorln("spool: failed to spool lines")
+		return cause
+	}
+	c.pending[key] = true
+	logrus.WithError(cause).WithField("key", key).WithField("num_lines", len(lines)).
+		Warnln("spool: spooled lines that could not be written")
+	return nil
+}
+
+// Upload uploads the full logs. If the logs cannot be uploaded
+// they are spooled and delivered in the background.
+func (c *spoolClient) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	// the uploaded logs include the lines of the live stream.
+	c.mu.Lock()
+	if c.pending[key] {
+		if err := c.spool.removePending(key); err != nil {
+			logrus.WithError(err).WithField("key", key).Errorln("spool: failed to remove spooled lines")
+		}
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+
+	uctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	err := c.Client.Upload(uctx, key, lines)
+	if err == nil {
+		return nil
+	}
+	if serr := c.spool.store(key, c.target, lines); serr != nil {
+		logrus.WithError(serr).WithField("key", key).Errorln("spool: failed to spool logs")
+		return err
+	}
+	logrus.WithError(err).WithField("key", key).
+		Warnln("spool: spooled logs that could not be uploaded")
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package spool provides a disk backed queue for logs that could
+// not be delivered to the log service. Undelivered uploads are
+// replayed in the background, including after a runner restart.
+package spool
+
+import (
+	"context"
+	"crypto/sha1" // nolint:gosec
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+const (
+	uploadExt  = ".upload"
+	pendingExt = ".pending"
+
+	defaultInterval = 30 * time.Second
+	defaultMaxAge   = 72 * time.Hour
+	uploadTimeout   = 5 * time.Minute
+)
+
+// DialFunc returns the client used to deliver an upload to the
+// target it was spooled for.
+type DialFunc func(target []byte) (logstream.Client, error)
+
+// Stats provides the size of the spool.
+type Stats struct {
+	Uploads int   // number of uploads waiting for delivery
+	Bytes   int64 // size of the spool on disk
+}
+
+// entry is an upload stored in the spool.
+type entry struct {
+	Key     string            `json:"key"`
+	Target  json.RawMessage   `json:"target"`
+	Created time.Time         `json:"created"`
+	Lines   []*logstream.Line `json:"lines"`
+}
+
+// Spool is a disk backed queue of log uploads.
+type Spool struct {
+	dir      string
+	dial     DialFunc
+	interval time.Duration
+	maxAge   time.Duration
+
+	mu sync.Mutex // serializes access to the spool files
+}
+
+// New returns a spool that stores undelivered logs in dir.
+func New(dir string, dial DialFunc) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, err
+	}
+	// the spooled logs are only readable by the runner, even if the
+	// directory existed.
+	if err := os.Chmod(dir, 0700); err != nil { // nolint:gomnd
+		return nil, err
+	}
+	return &Spool{
+		dir:      dir,
+		dial:     dial,
+		interval: defaultInterval,
+		maxAge:   defaultMaxAge,
+	}, nil
+}
+
+// Wrap returns a client that spools the logs the client fails to
+// deliver. The target is stored with spooled uploads and passed to
+// the dial function when they are replayed. The target is written to
+// disk as is, so it must not contain credentials.
+func (s *Spool) Wrap(client logstream.Client, target []byte) logstream.Client {
+	return &spoolClient{
+		Client:  client,
+		spool:   s,
+		target:  target,
+		pending: map[string]bool{},
+	}
+}
+
+// Start replays the spooled uploads until the context is canceled.
+// Lines spooled for a live stream are discarded, since the stream
+// did not survive the restart of the runner.
+func (s *Spool) Start(ctx context.Context) {
+	s.mu.Lock()
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "*"+pendingExt))
+	for _, path := range matches {
+		os.Remove(path)
+	}
+	s.mu.Unlock()
+
+	for {
+		s.replay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// Stats returns the size of the spool.
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats Stats
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return stats
+	}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(file.Name(), uploadExt) {
+			stats.Uploads++
+		}
+		stats.Bytes += info.Size()
+	}
+	return stats
+}
+
+// replay attempts to deliver the spooled uploads.
+func (s *Spool) replay(ctx context.Context) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*"+uploadExt))
+	if err != nil {
+		return
+	}
+	for _, path := range matches {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.deliver(ctx, path); err != nil {
+			logrus.WithError(err).WithField("path", path).
+				Warnln("spool: failed to deliver spooled logs")
+		}
+	}
+}
+
+// deliver uploads the spooled entry and removes it on success.
+func (s *Spool) deliver(ctx context.Context, path string) error {
+	s.mu.Lock()
+	data, err := os.ReadFile(path)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	e := new(entry)
+	if err := json.Unmarshal(data, e); err != nil {
+		logrus.WithError(err).WithField("path", path).Errorln("spool: discarding corrupt entry")
+		return s.remove(path)
+	}
+	if time.Since(e.Created) > s.maxAge {
+		logrus.WithField("key", e.Key).WithField("created", e.Created).
+			Errorln("spool: discarding expired logs")
+		return s.remove(path)
+	}
+
+	client, err := s.dial(e.Target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	if err := client.Upload(ctx, e.Key, e.Lines); err != nil {
+		return err
+	}
+	if err := client.Close(ctx, e.Key); err != nil {
+		logrus.WithError(err).WithField("key", e.Key).Debugln("spool: failed to close log stream")
+	}
+	logrus.WithField("key", e.Key).Infoln("spool: delivered spooled logs")
+	return s.remove(path)
+}
+
+// store writes the upload to the spool.
+func (s *Spool) store(key string, target []byte, lines []*logstream.Line) error {
+	data, err := json.Marshal(&entry{
+		Key:     key,
+		Target:  target,
+		Created: time.Now(),
+		Lines:   lines,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write to a temporary file first so that a partially
+	// written entry is never replayed.
+	path := s.path(key, uploadExt)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil { // nolint:gomnd
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// appendPending appends lines of a live stream to the spool.
+func (s *Spool) appendPending(key string, lines []*logstream.Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path(key, pendingExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) // nolint:gomnd
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// readPending returns the lines of a live stream in the spool.
+func (s *Spool) readPending(key string) ([]*logstream.Line, error) {
+	s.mu.Lock()
+	f, err := os.Open(s.path(key, pendingExt))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []*logstream.Line
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		line := new(logstream.Line)
+		if err := dec.Decode(line); err != nil {
+			// the last line may be truncated if the runner
+			// stopped while it was written.
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// removePending removes the lines of a live stream from the spool.
+func (s *Spool) removePending(key string) error {
+	return s.remove(s.path(key, pendingExt))
+}
+
+func (s *Spool) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the spool file of the key. The key is hashed
+// since it may contain characters that are not valid in a
+// file name.
+func (s *Spool) path(key, ext string) string {
+	sum := sha1.Sum([]byte(key)) // nolint:gosec
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+ext)
+}
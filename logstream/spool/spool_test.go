@@ -0,0 +1,103 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package spool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+type fakeClient struct {
+	fail     bool
+	written  []string
+	uploaded map[string]int
+}
+
+func (c *fakeClient) Upload(_ context.Context, key string, lines []*logstream.Line) error {
+	if c.fail {
+		return errors.New("unavailable")
+	}
+	c.uploaded[key] = len(lines)
+	return nil
+}
+
+func (c *fakeClient) Open(context.Context, string) error  { return nil }
+func (c *fakeClient) Close(context.Context, string) error { return nil }
+
+func (c *fakeClient) Write(_ context.Context, _ string, lines []*logstream.Line) error {
+	if c.fail {
+		return errors.New("unavailable")
+	}
+	for _, line := range lines {
+		c.written = append(c.written, line.Message)
+	}
+	return nil
+}
+
+func TestSpoolReplay(t *testing.T) {
+	client := &fakeClient{fail: true, uploaded: map[string]int{}}
+	s, err := New(t.TempDir(), func(target []byte) (logstream.Client, error) {
+		if string(target) != `{"url":"http://logs"}` {
+			t.Errorf("Unexpected target %s", target)
+		}
+		return client, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := s.Wrap(client, []byte(`{"url":"http://logs"}`))
+	lines := []*logstream.Line{{Message: "a"}, {Message: "b"}}
+	if err := c.Upload(context.Background(), "key", lines); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Stats().Uploads; got != 1 {
+		t.Fatalf("Want 1 spooled upload, got %d", got)
+	}
+
+	// the upload remains spooled while the service is unavailable.
+	s.replay(context.Background())
+	if got := s.Stats().Uploads; got != 1 {
+		t.Fatalf("Want 1 spooled upload, got %d", got)
+	}
+
+	client.fail = false
+	s.replay(context.Background())
+	if got := s.Stats(); got.Uploads != 0 || got.Bytes != 0 {
+		t.Errorf("Want empty spool, got %+v", got)
+	}
+	if got := client.uploaded["key"]; got != 2 {
+		t.Errorf("Want 2 uploaded lines, got %d", got)
+	}
+}
+
+func TestSpoolWrite(t *testing.T) {
+	client := &fakeClient{fail: true}
+	s, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := s.Wrap(client, nil)
+	if err := c.Write(context.Background(), "key", []*logstream.Line{{Message: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(context.Background(), "key", []*logstream.Line{{Message: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	client.fail = false
+	if err := c.Write(context.Background(), "key", []*logstream.Line{{Message: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.written; len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("Unexpected lines %q", got)
+	}
+	if got := s.Stats().Bytes; got != 0 {
+		t.Errorf("Want empty spool, got %d bytes", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"io"
+	"time"
+)
+
+// Streams a log line can originate from.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// StreamWriter is implemented by writers that keep track of the
+// stream, stdout or stderr, the output was written to and of the
+// time the output was produced.
+type StreamWriter interface {
+	// WriteStream writes p to the stream. A zero timestamp means
+	// the output was produced at the time of the write.
+	WriteStream(stream string, ts time.Time, p []byte) (int, error)
+}
+
+// WriteStream writes p to the stream of w. If w does not keep track
+// of streams p is written to w unchanged.
+func WriteStream(w io.Writer, stream string, ts time.Time, p []byte) (int, error) {
+	if sw, ok := w.(StreamWriter); ok {
+		return sw.WriteStream(stream, ts, p)
+	}
+	return w.Write(p)
+}
+
+// NewStreamWriter returns a writer that writes to the stream of w.
+// If w does not keep track of streams the writes are passed to w
+// unchanged.
+func NewStreamWriter(w io.Writer, stream string) io.Writer {
+	if sw, ok := w.(StreamWriter); ok {
+		return &streamWriter{w: sw, stream: stream}
+	}
+	return w
+}
+
+type streamWriter struct {
+	w      StreamWriter
+	stream string
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	return s.w.WriteStream(s.stream, time.Time{}, p)
+}
@@ -12,4 +12,20 @@ type Line struct {
 	ElaspedTime int64
 	Number      int
 	Timestamp   time.Time
+	Stream      string            // stdout or stderr, empty if unknown
+	Args        map[string]string // structured fields extracted from the message
+}
+
+// Fields returns the structured fields of the line, including the
+// stream it was written to. It returns nil if the line has none.
+func (l *Line) Fields() map[string]string {
+	if l.Stream == "" {
+		return l.Args
+	}
+	fields := make(map[string]string, len(l.Args)+1)
+	for k, v := range l.Args {
+		fields[k] = v
+	}
+	fields["stream"] = l.Stream
+	return fields
 }
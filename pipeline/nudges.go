@@ -0,0 +1,62 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+// defaultNudges are looked for in the last lines of the logs.
+var defaultNudges = []logstream.NudgeRule{
+	{
+		Search:     "[Kk]illed",
+		Error:      "out of memory",
+		Resolution: "Increase memory resources for the step",
+		Window:     10, // nolint:gomnd
+	},
+	{
+		Search:     ".*git.* SSL certificate problem",
+		Error:      "SSL certificate error",
+		Resolution: "Set sslVerify to false in CI codebase properties",
+		Window:     10, // nolint:gomnd
+	},
+	{
+		Search:     "Cannot connect to the Docker daemon",
+		Error:      "could not connect to the docker daemon",
+		Resolution: "Setup dind if it's not running. If dind is running, privileged should be set to true",
+		Window:     10, // nolint:gomnd
+	},
+}
+
+// nudges are looked for in the logs of the steps.
+var nudges = compileNudges(defaultNudges)
+
+// LoadNudges loads the nudges looked for in the logs from the file
+// at path.
+func LoadNudges(path string) error {
+	loaded, err := logstream.LoadNudges(path, compileNudges(defaultNudges))
+	if err != nil {
+		return err
+	}
+	nudges = loaded
+	return nil
+}
+
+// Nudges returns the nudges looked for in the logs.
+func Nudges() []logstream.Nudge {
+	return nudges
+}
+
+func compileNudges(rules []logstream.NudgeRule) []logstream.Nudge {
+	out := make([]logstream.Nudge, 0, len(rules))
+	for _, rule := range rules {
+		n, err := logstream.NewNudgeFromRule(rule)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxPortAttempts is the number of times the runner asks the
+// kernel for a free port before giving up.
+const maxPortAttempts = 10
+
+// hostPorts tracks the ephemeral host ports handed out to the
+// stages running on this runner, so that two stages are never
+// given the same port before docker has bound it.
+var hostPorts = &portAllocator{inUse: map[int]bool{}}
+
+type portAllocator struct {
+	sync.Mutex
+	inUse map[int]bool
+}
+
+// allocate returns a free host port for the protocol.
+func (a *portAllocator) allocate(proto string) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+	for i := 0; i < maxPortAttempts; i++ {
+		port, err := freePort(proto)
+		if err != nil {
+			return 0, err
+		}
+		if !a.inUse[port] {
+			a.inUse[port] = true
+			return port, nil
+		}
+	}
+	return 0, errors.New("cannot find a free host port")
+}
+
+func (a *portAllocator) release(ports []int) {
+	a.Lock()
+	defer a.Unlock()
+	for _, port := range ports {
+		delete(a.inUse, port)
+	}
+}
+
+// helper function asks the kernel for a free port.
+func freePort(proto string) (int, error) {
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// IsDynamicPort returns true if the host port of a port binding
+// should be allocated by the runner. This is the case for port 0
+// and for auto, which may be suffixed (eg auto-db) when a step
+// needs more than one dynamic port.
+func IsDynamicPort(hostPort string) bool {
+	return hostPort == "0" || hostPort == "auto" || strings.HasPrefix(hostPort, "auto-")
+}
+
+// PortEnv returns the name of the environment variable holding
+// the host port assigned to the container port of the step, eg
+// HARNESS_HOST_PORT_POSTGRES_5432.
+func PortEnv(stepID, ctrPort string) string {
+	port, proto := splitPort(ctrPort)
+	name := "HARNESS_HOST_PORT_" + stepID + "_" + port
+	if proto != "tcp" {
+		name += "_" + proto
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+}
+
+// AllocatePorts replaces the dynamic host ports of the port bindings
+// with free ports. The ports are tracked by the stage and released
+// when the stage is destroyed. The bindings allocated to a step are
+// returned if the step is started again.
+func (s *State) AllocatePorts(stepID string, bindings map[string]string) (map[string]string, error) {
+	s.portsMu.Lock()
+	defer s.portsMu.Unlock()
+
+	if allocated, ok := s.bindings[stepID]; ok {
+		return copyBindings(allocated), nil
+	}
+	allocated := make(map[string]string, len(bindings))
+	for hostPort, ctrPort := range bindings {
+		if !IsDynamicPort(hostPort) {
+			allocated[hostPort] = ctrPort
+			continue
+		}
+		_, proto := splitPort(ctrPort)
+		port, err := hostPorts.allocate(proto)
+		if err != nil {
+			return nil, fmt.Errorf("cannot allocate host port for container port %s: %w", ctrPort, err)
+		}
+		s.ports = append(s.ports, port)
+		if s.portEnvs == nil {
+			s.portEnvs = map[string]string{}
+		}
+		s.portEnvs[PortEnv(stepID, ctrPort)] = strconv.Itoa(port)
+		allocated[strconv.Itoa(port)] = ctrPort
+	}
+	if s.bindings == nil {
+		s.bindings = map[string]map[string]string{}
+	}
+	s.bindings[stepID] = allocated
+	return copyBindings(allocated), nil
+}
+
+// GetPortEnvs returns the environment variables holding the host
+// ports allocated to the steps of the stage.
+func (s *State) GetPortEnvs() map[string]string {
+	s.portsMu.Lock()
+	defer s.portsMu.Unlock()
+	envs := make(map[string]string, len(s.portEnvs))
+	for k, v := range s.portEnvs {
+		envs[k] = v
+	}
+	return envs
+}
+
+// ReleasePorts releases the host ports allocated to the stage.
+func (s *State) ReleasePorts() {
+	s.portsMu.Lock()
+	defer s.portsMu.Unlock()
+	hostPorts.release(s.ports)
+	s.ports = nil
+	s.portEnvs = nil
+	s.bindings = nil
+}
+
+func copyBindings(bindings map[string]string) map[string]string {
+	c := make(map[string]string, len(bindings))
+	for k, v := range bindings {
+		c[k] = v
+	}
+	return c
+}
+
+// helper function splits the container port into the port
+// number and protocol, eg 53/udp.
+func splitPort(ctrPort string) (port, proto string) {
+	port, proto = ctrPort, "tcp"
+	if i := strings.Index(ctrPort, "/"); i != -1 {
+		port, proto = ctrPort[:i], strings.ToLower(ctrPort[i+1:])
+	}
+	return port, proto
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocatePorts(t *testing.T) {
+	s1, s2 := NewState(), NewState()
+
+	b1, err := s1.AllocatePorts("postgres", map[string]string{"auto": "5432", "8080": "80"})
+	assert.Nil(t, err)
+	b2, err := s2.AllocatePorts("dns", map[string]string{"0": "53/udp", "auto-web": "8080"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "80", b1["8080"])
+	assert.Len(t, b1, 2)
+	assert.Len(t, b2, 2)
+
+	envs := s1.GetPortEnvs()
+	port := envs["HARNESS_HOST_PORT_POSTGRES_5432"]
+	assert.Equal(t, "5432", b1[port])
+	for hostPort := range b2 {
+		assert.NotEqual(t, port, hostPort)
+	}
+	assert.Contains(t, s2.GetPortEnvs(), "HARNESS_HOST_PORT_DNS_53_UDP")
+
+	p, _ := strconv.Atoi(port)
+	assert.True(t, hostPorts.inUse[p])
+	s1.ReleasePorts()
+	assert.False(t, hostPorts.inUse[p])
+	assert.Empty(t, s1.GetPortEnvs())
+	s2.ReleasePorts()
+}
+
+func TestAllocatePortsRepeated(t *testing.T) {
+	s := NewState()
+	defer s.ReleasePorts()
+
+	b1, err := s.AllocatePorts("postgres", map[string]string{"auto": "5432"})
+	assert.Nil(t, err)
+	ports := len(s.ports)
+
+	// the step is started again, eg the request is re-sent.
+	b2, err := s.AllocatePorts("postgres", map[string]string{"auto": "5432"})
+	assert.Nil(t, err)
+	assert.Equal(t, b1, b2)
+	assert.Len(t, s.ports, ports)
+	assert.Len(t, s.GetPortEnvs(), 1)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/engine"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+// output variables of the build step
+const (
+	buildOutputImageID = "IMAGE_ID"
+	buildOutputDigest  = "IMAGE_DIGEST"  // digest of the first pushed tag
+	buildOutputDigests = "IMAGE_DIGESTS" // comma separated list of pushed tag@digest
+)
+
+func executeBuildStep(ctx context.Context, engine *engine.Engine, r *api.StartStepRequest, out io.Writer) (
+	*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, error) {
+	telemetry := &types.TelemetryData{}
+	optimizationState := types.DISABLED
+	step := toStep(r)
+
+	logrus.WithField("step_id", r.ID).WithField("stage_id", r.StageRuntimeID).Infoln("starting image build")
+	exited, result, err := engine.Build(ctx, step, &r.Build, out)
+	if err != nil || result == nil {
+		return exited, nil, nil, nil, string(optimizationState), telemetry, err
+	}
+
+	outputs := map[string]string{}
+	if result.ImageID != "" {
+		outputs[buildOutputImageID] = result.ImageID
+	}
+	var digests []string
+	for _, tag := range r.Build.Tags {
+		digest, ok := result.Digests[tag]
+		if !ok || digest == "" {
+			continue
+		}
+		if len(digests) == 0 {
+			outputs[buildOutputDigest] = digest
+		}
+		digests = append(digests, tag+"@"+digest)
+	}
+	if len(digests) > 0 {
+		outputs[buildOutputDigests] = strings.Join(digests, ",")
+	}
+
+	var outputsV2 []*api.OutputV2
+	for _, key := range []string{buildOutputImageID, buildOutputDigest, buildOutputDigests} {
+		if value, ok := outputs[key]; ok {
+			outputsV2 = append(outputsV2, &api.OutputV2{Key: key, Value: value, Type: api.OutputTypeString})
+		}
+	}
+	return exited, outputs, nil, outputsV2, string(optimizationState), telemetry, nil
+}
@@ -6,6 +6,7 @@ package runtime
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +19,8 @@ import (
 	"github.com/harness/harness-docker-runner/engine"
 	"github.com/harness/harness-docker-runner/engine/spec"
 	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/pipeline"
+	"github.com/harness/harness-docker-runner/tracing"
 	"github.com/sirupsen/logrus"
 
 	leapi "github.com/harness/lite-engine/api"
@@ -31,15 +34,15 @@ const (
 )
 
 func getNudges() []logstream.Nudge {
-	// <search-term> <resolution> <error-msg>
-	return []logstream.Nudge{
-		logstream.NewNudge("[Kk]illed", "Increase memory resources for the step", errors.New("out of memory")),
-		logstream.NewNudge(".*git.* SSL certificate problem",
-			"Set sslVerify to false in CI codebase properties", errors.New("SSL certificate error")),
-		logstream.NewNudge("Cannot connect to the Docker daemon",
-			"Setup dind if it's not running. If dind is running, privileged should be set to true",
-			errors.New("could not connect to the docker daemon")),
-	}
+	return pipeline.Nudges()
+}
+
+// traced runs fn in a span with the given name.
+func traced(ctx context.Context, name string, fn func(context.Context) error) error {
+	ctx, span := tracing.Start(ctx, name)
+	err := fn(ctx)
+	tracing.End(span, err)
+	return err
 }
 
 func getOutputVarCmd(entrypoint, outputVars []string, outputFile string, shouldEnableDotEnvSupport bool) string {
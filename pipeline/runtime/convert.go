@@ -27,12 +27,14 @@ func toStep(r *api.StartStepRequest) *spec.Step {
 		IgnoreStdout: r.IgnoreStdout,
 		IgnoreStderr: r.IgnoreStderr,
 		Image:        r.Image,
+		Platform:     r.Platform,
 		Labels:       r.Labels,
 		MemSwapLimit: r.MemSwapLimit,
 		MemLimit:     r.MemLimit,
 		Name:         r.Name,
 		Network:      r.Network,
 		Networks:     r.Networks,
+		PidsLimit:    r.PidsLimit,
 		PortBindings: r.PortBindings,
 		Privileged:   r.Privileged,
 		Pull:         r.Pull,
@@ -0,0 +1,185 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/engine"
+	"github.com/harness/harness-docker-runner/pipeline"
+	"github.com/harness/harness-docker-runner/setup"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pluginKindAction  = "action"
+	pluginKindBitrise = "bitrise"
+)
+
+// executeHostPluginStep runs a GitHub Action or Bitrise step on the
+// host with the plugin binary. Action inputs are passed to the plugin
+// as json in PLUGIN_WITH, Bitrise inputs as environment variables.
+// Bitrise outputs are captured with envman.
+func executeHostPluginStep(ctx context.Context, engine *engine.Engine, r *api.StartStepRequest, out io.Writer) (
+	*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, error) {
+	telemetry := &types.TelemetryData{}
+	optimizationState := string(types.DISABLED)
+
+	kind, config := pluginKindAction, r.Action
+	if r.Kind == api.Bitrise {
+		kind, config = pluginKindBitrise, r.Bitrise
+	}
+	if config.Uses == "" {
+		return nil, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("%s step requires uses to be set", kind)
+	}
+	if r.Image != "" {
+		return nil, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("%s step runs on the host and cannot set an image", kind)
+	}
+
+	instanceInfo := setup.GetInstanceInfo()
+	pluginPath, err := setup.PluginPath(instanceInfo)
+	if err != nil {
+		return nil, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("cannot run %s step: %w", kind, err)
+	}
+
+	step := toStep(r)
+	if step.Envs == nil {
+		step.Envs = map[string]string{}
+	}
+	step.Entrypoint = []string{pluginPath}
+	step.Command = []string{"-kind", kind, "-name", config.Uses}
+
+	outputFile := fmt.Sprintf("%s/%s-output.env", pipeline.SharedVolPath, step.ID)
+	step.Envs["DRONE_OUTPUT"] = outputFile
+	defer removeFile(outputFile)
+
+	var envmanPath, envstore string
+	switch kind {
+	case pluginKindAction:
+		if len(config.With) > 0 {
+			with, err := json.Marshal(config.With)
+			if err != nil {
+				return nil, nil, nil, nil, optimizationState, telemetry, err
+			}
+			step.Envs["PLUGIN_WITH"] = string(with)
+		}
+	case pluginKindBitrise:
+		if envmanPath, err = setup.EnvmanPath(instanceInfo); err != nil {
+			return nil, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("cannot run %s step: %w", kind, err)
+		}
+		envstore = fmt.Sprintf("%s/%s-envstore.yml", pipeline.SharedVolPath, step.ID)
+		if err := envman(ctx, envmanPath, envstore, nil, "init", "--clear"); err != nil {
+			return nil, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("cannot initialize envman store: %w", err)
+		}
+		defer removeFile(envstore)
+		step.Envs["ENVMAN_ENVSTORE_PATH"] = envstore
+		for k, v := range config.With {
+			step.Envs[k] = v
+		}
+	}
+
+	logrus.WithField("step_id", r.ID).WithField("stage_id", r.StageRuntimeID).
+		WithField("kind", kind).WithField("uses", config.Uses).Infoln("starting host plugin step")
+	fmt.Fprintf(out, "Running %s %s\n", kind, config.Uses)
+
+	exited, err := engine.Run(ctx, step, out)
+	if err != nil || exited == nil || !exited.Exited || exited.ExitCode != 0 {
+		return exited, nil, nil, nil, optimizationState, telemetry, err
+	}
+
+	outputs, err := fetchExportedVarsFromEnvFile(outputFile, out)
+	if err != nil {
+		return exited, nil, nil, nil, optimizationState, telemetry, err
+	}
+	if envstore != "" {
+		envs, err := envmanOutputs(ctx, envmanPath, envstore)
+		if err != nil {
+			return exited, nil, nil, nil, optimizationState, telemetry, fmt.Errorf("cannot read outputs from envman: %w", err)
+		}
+		for k, v := range envs {
+			outputs[k] = v
+		}
+	}
+
+	outputs = filterOutputs(r, outputs)
+	outputsV2 := []*api.OutputV2{}
+	for key, value := range outputs {
+		outputsV2 = append(outputsV2, &api.OutputV2{Key: key, Value: value, Type: outputType(r, key)})
+	}
+	return exited, outputs, nil, outputsV2, optimizationState, telemetry, nil
+}
+
+// helper function returns the envs added to the envman store by
+// the bitrise step.
+func envmanOutputs(ctx context.Context, path, envstore string) (map[string]string, error) {
+	var stdout []byte
+	if err := envman(ctx, path, envstore, &stdout, "print", "--format", "json"); err != nil {
+		return nil, err
+	}
+	outputs := map[string]string{}
+	if err := json.Unmarshal(stdout, &outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// helper function runs envman against the envstore.
+func envman(ctx context.Context, path, envstore string, stdout *[]byte, args ...string) error {
+	cmd := exec.CommandContext(ctx, path, append([]string{"--path", envstore}, args...)...) //nolint:gosec
+	b, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("%w: %s", err, ee.Stderr)
+		}
+		return err
+	}
+	if stdout != nil {
+		*stdout = b
+	}
+	return nil
+}
+
+// helper function returns the outputs requested by the step, or all
+// outputs if none were requested.
+func filterOutputs(r *api.StartStepRequest, outputs map[string]string) map[string]string {
+	if len(r.Outputs) == 0 && len(r.OutputVars) == 0 {
+		return outputs
+	}
+	filtered := map[string]string{}
+	for _, output := range r.Outputs {
+		if v, ok := outputs[output.Key]; ok {
+			filtered[output.Key] = v
+		}
+	}
+	for _, key := range r.OutputVars {
+		if v, ok := outputs[key]; ok {
+			filtered[key] = v
+		}
+	}
+	return filtered
+}
+
+func outputType(r *api.StartStepRequest, key string) api.OutputType {
+	for _, output := range r.Outputs {
+		if output.Key == key {
+			return output.Type
+		}
+	}
+	return api.OutputTypeString
+}
+
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).WithField("file", path).Warnln("could not remove file")
+	}
+}
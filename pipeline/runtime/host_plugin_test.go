@@ -0,0 +1,25 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterOutputs(t *testing.T) {
+	outputs := map[string]string{"VERSION": "1.0", "DIGEST": "sha256:abc", "OTHER": "x"}
+
+	r := &api.StartStepRequest{}
+	assert.Equal(t, outputs, filterOutputs(r, outputs))
+
+	r.OutputVars = []string{"VERSION", "MISSING"}
+	r.Outputs = []*api.OutputV2{{Key: "DIGEST", Type: api.OutputTypeSecret}}
+	assert.Equal(t, map[string]string{"VERSION": "1.0", "DIGEST": "sha256:abc"}, filterOutputs(r, outputs))
+	assert.Equal(t, api.OutputTypeSecret, outputType(r, "DIGEST"))
+	assert.Equal(t, api.OutputTypeString, outputType(r, "VERSION"))
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/engine"
+	"github.com/harness/harness-docker-runner/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+// fake plugin binary. Actions export their PLUGIN_WITH input, Bitrise
+// steps add their input to the envman store.
+const fakePlugin = `#!/bin/sh
+if [ "$1" = "healthz" ]; then
+	[ -z "$FAKE_PLUGIN_UNHEALTHY" ] && exit 0
+	echo "broken" >&2
+	exit 1
+fi
+if [ "$2" = "action" ]; then
+	echo "WITH=$PLUGIN_WITH" >> "$DRONE_OUTPUT"
+	echo "OTHER=x" >> "$DRONE_OUTPUT"
+else
+	echo "{\"VERSION\":\"$version\"}" > "$ENVMAN_ENVSTORE_PATH.json"
+fi
+echo "ran $4"
+`
+
+// fake envman binary, which prints the outputs written by the fake
+// plugin.
+const fakeEnvman = `#!/bin/sh
+store="$2"
+case "$3" in
+version) exit 0 ;;
+init) rm -f "$store.json" ;;
+print) cat "$store.json" ;;
+esac
+`
+
+// helper function writes the binaries to a directory added to PATH,
+// and returns an engine that runs the host steps.
+func setupHostPlugin(t *testing.T, binaries map[string]string) (*engine.Engine, string) {
+	dir := t.TempDir()
+	for name, script := range binaries {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil { // nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err := os.MkdirAll(pipeline.SharedVolPath, 0777); err != nil { // nolint:gomnd
+		t.Fatal(err)
+	}
+	e, err := engine.NewEnv(engine.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, dir
+}
+
+func TestHostPluginAction(t *testing.T) {
+	e, _ := setupHostPlugin(t, map[string]string{"plugin": fakePlugin})
+
+	r := &api.StartStepRequest{}
+	r.ID = "host-plugin-action"
+	r.Kind = api.Action
+	r.Action = api.HostPluginConfig{Uses: "actions/hello@v1", With: map[string]string{"name": "octocat"}}
+	r.OutputVars = []string{"WITH"}
+
+	out := new(bytes.Buffer)
+	exited, outputs, _, outputsV2, _, _, err := executeHostPluginStep(context.Background(), e, r, out)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exited.ExitCode)
+	assert.Contains(t, out.String(), "ran actions/hello@v1")
+	// only the requested outputs are returned.
+	assert.Equal(t, map[string]string{"WITH": `{"name":"octocat"}`}, outputs)
+	assert.Equal(t, []*api.OutputV2{{Key: "WITH", Value: `{"name":"octocat"}`, Type: api.OutputTypeString}}, outputsV2)
+}
+
+func TestHostPluginBitrise(t *testing.T) {
+	e, _ := setupHostPlugin(t, map[string]string{"plugin": fakePlugin, "envman": fakeEnvman})
+
+	r := &api.StartStepRequest{}
+	r.ID = "host-plugin-bitrise"
+	r.Kind = api.Bitrise
+	r.Bitrise = api.HostPluginConfig{Uses: "git::https://github.com/bitrise-steplib/steps-script.git", With: map[string]string{"version": "1.2.3"}}
+
+	exited, outputs, _, _, _, _, err := executeHostPluginStep(context.Background(), e, r, new(bytes.Buffer))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exited.ExitCode)
+	// the inputs are passed as envs and the outputs are read from envman.
+	assert.Equal(t, map[string]string{"VERSION": "1.2.3"}, outputs)
+}
+
+func TestHostPluginBinaryErrors(t *testing.T) {
+	r := &api.StartStepRequest{}
+	r.ID = "host-plugin-errors"
+	r.Kind = api.Bitrise
+	r.Bitrise = api.HostPluginConfig{Uses: "script"}
+
+	// keep only the fake binaries in PATH.
+	e, dir := setupHostPlugin(t, map[string]string{"plugin": fakePlugin})
+	t.Setenv("PATH", dir)
+	_, _, _, _, _, _, err := executeHostPluginStep(context.Background(), e, r, new(bytes.Buffer))
+	assert.EqualError(t, err, "cannot run bitrise step: envman binary not found in PATH")
+
+	t.Setenv("FAKE_PLUGIN_UNHEALTHY", "true")
+	_, _, _, _, _, _, err = executeHostPluginStep(context.Background(), e, r, new(bytes.Buffer))
+	assert.ErrorContains(t, err, "is not healthy")
+
+	t.Setenv("PATH", t.TempDir())
+	_, _, _, _, _, _, err = executeHostPluginStep(context.Background(), e, r, new(bytes.Buffer))
+	assert.EqualError(t, err, "cannot run bitrise step: plugin binary not found in PATH")
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/engine"
+	"github.com/harness/harness-docker-runner/engine/spec"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/types"
+)
+
+const (
+	pluginEnvPrefix = "PLUGIN_"
+	fromSecret      = "from_secret"
+)
+
+// executePluginStep runs a drone plugin. The plugin settings are
+// converted to PLUGIN_ environment variables and the plugin image
+// is run with its own entrypoint.
+func executePluginStep(ctx context.Context, engine *engine.Engine, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) (
+	*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, error) {
+	if r.Image == "" {
+		return nil, nil, nil, nil, string(types.DISABLED), &types.TelemetryData{}, fmt.Errorf("plugin step requires an image")
+	}
+	envs, err := pluginEnvs(r.Plugin.Settings, r.Plugin.Secrets)
+	if err != nil {
+		return nil, nil, nil, nil, string(types.DISABLED), &types.TelemetryData{}, err
+	}
+	if r.Envs == nil {
+		r.Envs = map[string]string{}
+	}
+	// as with drone, the settings take precedence over the
+	// environment of the step.
+	for k, v := range envs {
+		r.Envs[k] = v
+	}
+	r.Run = api.RunConfig{}
+	return executeRunStep(ctx, engine, r, out, tiConfig)
+}
+
+// pluginEnvs converts the plugin settings to environment variables.
+// Settings of the form {"from_secret": "name"} are replaced with the
+// value of the secret, including those nested in maps and lists.
+func pluginEnvs(settings map[string]interface{}, secrets []*spec.Secret) (map[string]string, error) {
+	envs := make(map[string]string, len(settings))
+	for key, value := range settings {
+		resolved, err := resolveSecrets(value, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("%s referenced by setting %s is not defined", err, key)
+		}
+		envs[pluginEnvKey(key)] = encodeSetting(resolved)
+	}
+	return envs, nil
+}
+
+// helper function returns the setting value with the secret
+// references replaced with the value of the secret. It returns the
+// name of the first secret that is not defined as the error.
+func resolveSecrets(value interface{}, secrets []*spec.Secret) (interface{}, error) {
+	if secret, ok := secretRef(value); ok {
+		data, found := lookupSecret(secrets, secret)
+		if !found {
+			return nil, fmt.Errorf("secret %s", secret)
+		}
+		return data, nil
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			r, err := resolveSecrets(item, secrets)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := resolveSecrets(item, secrets)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// helper function converts the setting name to the environment
+// variable name, eg docker-repo becomes PLUGIN_DOCKER_REPO.
+func pluginEnvKey(key string) string {
+	key = strings.ToUpper(key)
+	return pluginEnvPrefix + strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// helper function returns the secret name if the setting value
+// is a secret reference.
+func secretRef(value interface{}) (string, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	name, ok := m[fromSecret].(string)
+	return name, ok
+}
+
+func lookupSecret(secrets []*spec.Secret, name string) (string, bool) {
+	for _, secret := range secrets {
+		if secret != nil && secret.Name == name {
+			return string(secret.Data), true
+		}
+	}
+	return "", false
+}
+
+// encodeSetting encodes the setting value the same way as drone.
+// Scalars are converted to strings, lists of scalars are comma
+// separated and all other values are json encoded.
+func encodeSetting(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case []interface{}:
+		return encodeSlice(v)
+	default:
+		return jsonify(v)
+	}
+}
+
+func encodeSlice(values []interface{}) string {
+	var parts []string
+	for _, value := range values {
+		switch value.(type) {
+		case string, bool, float64, int:
+			parts = append(parts, encodeSetting(value))
+		default:
+			return jsonify(values)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func jsonify(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/harness/harness-docker-runner/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginEnvs(t *testing.T) {
+	var settings map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"repo": "octocat/hello-world",
+		"auto-tag": true,
+		"retries": 3,
+		"timeout": 1.5,
+		"tags": ["latest", "1.0"],
+		"build_args": {"foo": "bar", "baz": 1},
+		"mirrors": [{"url": "https://mirror"}],
+		"empty": null,
+		"password": {"from_secret": "docker_password"}
+	}`), &settings)
+	assert.Nil(t, err)
+
+	secrets := []*spec.Secret{{Name: "docker_password", Data: []byte("correct-horse")}}
+	envs, err := pluginEnvs(settings, secrets)
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]string{
+		"PLUGIN_REPO":       "octocat/hello-world",
+		"PLUGIN_AUTO_TAG":   "true",
+		"PLUGIN_RETRIES":    "3",
+		"PLUGIN_TIMEOUT":    "1.5",
+		"PLUGIN_TAGS":       "latest,1.0",
+		"PLUGIN_BUILD_ARGS": `{"baz":1,"foo":"bar"}`,
+		"PLUGIN_MIRRORS":    `[{"url":"https://mirror"}]`,
+		"PLUGIN_EMPTY":      "",
+		"PLUGIN_PASSWORD":   "correct-horse",
+	}, envs)
+}
+
+func TestPluginEnvsMissingSecret(t *testing.T) {
+	settings := map[string]interface{}{
+		"token": map[string]interface{}{"from_secret": "github_token"},
+	}
+	_, err := pluginEnvs(settings, nil)
+	assert.NotNil(t, err)
+}
+
+func TestPluginEnvsNestedSecret(t *testing.T) {
+	var settings map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"build_args": {"token": {"from_secret": "npm_token"}},
+		"registries": [{"url": "https://mirror", "password": {"from_secret": "docker_password"}}],
+		"passwords": [{"from_secret": "docker_password"}, "plain"]
+	}`), &settings)
+	assert.Nil(t, err)
+
+	secrets := []*spec.Secret{
+		{Name: "docker_password", Data: []byte("correct-horse")},
+		{Name: "npm_token", Data: []byte("battery-staple")},
+	}
+	envs, err := pluginEnvs(settings, secrets)
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]string{
+		"PLUGIN_BUILD_ARGS": `{"token":"battery-staple"}`,
+		"PLUGIN_REGISTRIES": `[{"password":"correct-horse","url":"https://mirror"}]`,
+		"PLUGIN_PASSWORDS":  "correct-horse,plain",
+	}, envs)
+
+	settings["build_args"] = map[string]interface{}{
+		"token": map[string]interface{}{"from_secret": "github_token"},
+	}
+	_, err = pluginEnvs(settings, secrets)
+	assert.NotNil(t, err)
+}
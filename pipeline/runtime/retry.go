@@ -0,0 +1,113 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/errors"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+// exit code recorded for an attempt that failed without the
+// step exiting, eg because the container could not be created.
+const infraErrorExitCode = 255
+
+// runWithRetry runs the step and retries it according to the retry
+// policy of the request. The step timeout applies to all attempts.
+// It returns the result of the last attempt and the exit code of
+// every attempt.
+func (e *StepExecutor) runWithRetry(ctx context.Context, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) (
+	*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, []int, error) {
+	var exitCodes []int
+	for attempt := 1; ; attempt++ {
+		exited, outputs, artifact, outputV2, optimizationState, telemetry, err := e.run(ctx, e.engine, cloneRequest(r), out, tiConfig)
+		exitCodes = append(exitCodes, attemptExitCode(exited, err))
+
+		retry, reason := shouldRetry(r.RetryPolicy, attempt, exited, err)
+		if !retry || ctx.Err() != nil {
+			return exited, outputs, artifact, outputV2, optimizationState, telemetry, exitCodes, err
+		}
+
+		delay := retryDelay(r.RetryPolicy, attempt)
+		logrus.WithField("id", r.ID).WithField("attempt", attempt).WithError(err).Infoln("retrying step")
+		fmt.Fprintf(out, "Attempt %d of %d failed with %s, retrying in %s\n", attempt, r.RetryPolicy.MaxAttempts, reason, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return exited, outputs, artifact, outputV2, optimizationState, telemetry, exitCodes, err
+		}
+		fmt.Fprintf(out, "Starting attempt %d of %d\n", attempt+1, r.RetryPolicy.MaxAttempts)
+	}
+}
+
+// shouldRetry reports whether the attempt should be retried and
+// the reason it failed.
+func shouldRetry(policy *api.RetryPolicy, attempt int, exited *runtime.State, err error) (bool, string) {
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return false, ""
+	}
+	// an error without an exit state means the step could not be
+	// run at all. Only infra errors, eg the image could not be pulled
+	// or the container could not be started, are retried. Errors of
+	// the step configuration fail the same way on every attempt.
+	if exited == nil {
+		return errors.IsInfra(err) && policy.InfraErrors, fmt.Sprintf("error: %s", err)
+	}
+	if !exited.Exited || exited.ExitCode == 0 {
+		return false, ""
+	}
+	for _, code := range policy.ExitCodes {
+		if code == exited.ExitCode {
+			return true, fmt.Sprintf("exit code %d", exited.ExitCode)
+		}
+	}
+	return false, ""
+}
+
+// retryDelay returns the time to wait after the attempt.
+func retryDelay(policy *api.RetryPolicy, attempt int) time.Duration {
+	delay := time.Duration(policy.Backoff) * time.Second
+	for i := 1; i < attempt && policy.BackoffFactor > 1; i++ {
+		delay = time.Duration(float64(delay) * policy.BackoffFactor)
+	}
+	if max := time.Duration(policy.MaxBackoff) * time.Second; max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func attemptExitCode(exited *runtime.State, err error) int {
+	if exited == nil {
+		if err != nil {
+			return infraErrorExitCode
+		}
+		return 0
+	}
+	return exited.ExitCode
+}
+
+// helper function returns a copy of the request that a single
+// attempt can modify without affecting the next attempt.
+func cloneRequest(r *api.StartStepRequest) *api.StartStepRequest {
+	c := *r
+	c.Run.Command = append([]string(nil), r.Run.Command...)
+	c.RunTestsV2.Command = append([]string(nil), r.RunTestsV2.Command...)
+	if r.Envs != nil {
+		c.Envs = make(map[string]string, len(r.Envs))
+		for k, v := range r.Envs {
+			c.Envs[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/harness-docker-runner/api"
+	herrors "github.com/harness/harness-docker-runner/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRetry(t *testing.T) {
+	policy := &api.RetryPolicy{MaxAttempts: 3, ExitCodes: []int{2}, InfraErrors: true}
+	infraErr := &herrors.InfraError{Err: errors.New("failed to pull image")}
+	configErr := errors.New("output variable should not be set")
+
+	tests := []struct {
+		name    string
+		policy  *api.RetryPolicy
+		attempt int
+		exited  *runtime.State
+		err     error
+		want    bool
+	}{
+		{name: "no policy", policy: nil, attempt: 1, exited: &runtime.State{Exited: true, ExitCode: 2}, want: false},
+		{name: "configured exit code", policy: policy, attempt: 1, exited: &runtime.State{Exited: true, ExitCode: 2}, want: true},
+		{name: "other exit code", policy: policy, attempt: 1, exited: &runtime.State{Exited: true, ExitCode: 1}, want: false},
+		{name: "success", policy: policy, attempt: 1, exited: &runtime.State{Exited: true}, want: false},
+		{name: "infra error", policy: policy, attempt: 2, err: infraErr, want: true},
+		{name: "config error", policy: policy, attempt: 1, err: configErr, want: false},
+		{name: "infra error not retried", policy: &api.RetryPolicy{MaxAttempts: 3}, attempt: 1, err: infraErr, want: false},
+		{name: "attempts exhausted", policy: policy, attempt: 3, err: infraErr, want: false},
+	}
+	for _, test := range tests {
+		got, _ := shouldRetry(test.policy, test.attempt, test.exited, test.err)
+		assert.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &api.RetryPolicy{Backoff: 2, BackoffFactor: 2, MaxBackoff: 5}
+	assert.Equal(t, 2*time.Second, retryDelay(policy, 1))
+	assert.Equal(t, 4*time.Second, retryDelay(policy, 2))
+	assert.Equal(t, 5*time.Second, retryDelay(policy, 3))
+
+	assert.Equal(t, 3*time.Second, retryDelay(&api.RetryPolicy{Backoff: 3}, 4))
+}
+
+func TestCloneRequest(t *testing.T) {
+	r := &api.StartStepRequest{}
+	r.Run.Command = []string{"echo hello"}
+	r.Envs = map[string]string{"FOO": "bar"}
+
+	c := cloneRequest(r)
+	c.Run.Command[0] += "\necho output"
+	c.Envs["DRONE_OUTPUT"] = "/tmp/engine/step.out"
+
+	assert.Equal(t, "echo hello", r.Run.Command[0])
+	assert.NotContains(t, r.Envs, "DRONE_OUTPUT")
+}
@@ -70,18 +70,26 @@ func executeRunTestStep(ctx context.Context, engine *engine.Engine, r *api.Start
 
 	exited, err := engine.Run(ctx, step, out)
 	timeTakenMs := time.Since(start).Milliseconds()
-	if _, rerr := report.ParseAndUploadTests(ctx, r.TestReport, r.WorkingDir, step.Name, log, time.Now(), tiConfig, &telemetry.TestIntelligenceMetaData, r.Envs); rerr != nil {
+	if rerr := traced(ctx, "ti.upload_tests", func(ctx context.Context) error {
+		_, err := report.ParseAndUploadTests(ctx, r.TestReport, r.WorkingDir, step.Name, log, time.Now(), tiConfig, &telemetry.TestIntelligenceMetaData, r.Envs)
+		return err
+	}); rerr != nil {
 		log.WithError(rerr).Errorln("failed to upload report")
 	}
 
 	//Passing default false for failed test for now.
-	if uerr := callgraph.Upload(ctx, step.Name, time.Since(start).Milliseconds(), log, time.Now(), tiConfig, cgDir, false); uerr != nil {
+	if uerr := traced(ctx, "ti.upload_callgraph", func(ctx context.Context) error {
+		return callgraph.Upload(ctx, step.Name, time.Since(start).Milliseconds(), log, time.Now(), tiConfig, cgDir, false)
+	}); uerr != nil {
 		log.WithError(uerr).Errorln("unable to collect callgraph")
 	}
 
 	// Parse and upload savings to TI
 	if tiConfig.GetParseSavings() {
-		optimizationState = savings.ParseAndUploadSavings(ctx, r.WorkingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs, telemetry)
+		traced(ctx, "ti.upload_savings", func(ctx context.Context) error { // nolint:errcheck
+			optimizationState = savings.ParseAndUploadSavings(ctx, r.WorkingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs, telemetry)
+			return nil
+		})
 	}
 
 	summaryOutputs := make(map[string]string)
@@ -91,18 +91,26 @@ func executeRunTestsV2Step(ctx context.Context, engine *engine.Engine, r *api.St
 		// If there are no paths specified, set Paths[0] to include all XML files and all TRX files
 		r.TestReport.Junit.Paths = []string{"**/*.xml", "**/*.trx"}
 	}
-	if _, rerr := report.ParseAndUploadTests(ctx, r.TestReport, r.WorkingDir, step.Name, log, time.Now(), tiConfig, &telemetry.TestIntelligenceMetaData, r.Envs); rerr != nil {
+	if rerr := traced(ctx, "ti.upload_tests", func(ctx context.Context) error {
+		_, err := report.ParseAndUploadTests(ctx, r.TestReport, r.WorkingDir, step.Name, log, time.Now(), tiConfig, &telemetry.TestIntelligenceMetaData, r.Envs)
+		return err
+	}); rerr != nil {
 		log.WithError(rerr).Errorln("failed to upload report")
 	}
 
 	//Passing default false for failed test for now
-	if uerr := callgraph.Upload(ctx, step.Name, time.Since(start).Milliseconds(), log, time.Now(), tiConfig, outDir, false); uerr != nil {
+	if uerr := traced(ctx, "ti.upload_callgraph", func(ctx context.Context) error {
+		return callgraph.Upload(ctx, step.Name, time.Since(start).Milliseconds(), log, time.Now(), tiConfig, outDir, false)
+	}); uerr != nil {
 		log.WithError(uerr).Errorln("unable to collect callgraph")
 	}
 
 	// Parse and upload savings to TI
 	if tiConfig.GetParseSavings() {
-		optimizationState = savings.ParseAndUploadSavings(ctx, r.WorkingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs, telemetry)
+		traced(ctx, "ti.upload_savings", func(ctx context.Context) error { // nolint:errcheck
+			optimizationState = savings.ParseAndUploadSavings(ctx, r.WorkingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs, telemetry)
+			return nil
+		})
 	}
 
 	artifact, _ := fetchArtifactDataFromArtifactFile(artifactFile, out)
@@ -17,11 +17,14 @@ import (
 	"github.com/harness/harness-docker-runner/errors"
 	"github.com/harness/harness-docker-runner/livelog"
 	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/pipeline"
+	"github.com/harness/harness-docker-runner/tracing"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 	"github.com/harness/ti-client/types"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ExecutionStatus int
@@ -35,6 +38,10 @@ type StepStatus struct {
 	OutputV2          []*api.OutputV2
 	OptimizationState string
 	Telemetry         *types.TelemetryData
+	AttemptExitCodes  []int
+	Image             *api.ImageTelemetry
+	Log               *api.LogTelemetry
+	Nudges            []*api.Nudge
 }
 
 const (
@@ -49,6 +56,13 @@ type StepExecutor struct {
 	stepStatus map[string]StepStatus
 	stepLog    map[string]*StepLog
 	stepWaitCh map[string][]chan StepStatus
+	logResults map[string]logResult
+}
+
+// logResult is the result of the analysis of the logs of a step.
+type logResult struct {
+	telemetry *api.LogTelemetry
+	nudges    []*api.Nudge
 }
 
 func NewStepExecutor(engine *engine.Engine) *StepExecutor {
@@ -58,6 +72,7 @@ func NewStepExecutor(engine *engine.Engine) *StepExecutor {
 		stepWaitCh: make(map[string][]chan StepStatus),
 		stepLog:    make(map[string]*StepLog),
 		stepStatus: make(map[string]StepStatus),
+		logResults: make(map[string]logResult),
 	}
 }
 
@@ -76,10 +91,22 @@ func (e *StepExecutor) StartStep(ctx context.Context, r *api.StartStepRequest, s
 	e.stepStatus[r.ID] = StepStatus{Status: Running}
 	e.mu.Unlock()
 
+	// the step outlives the request, but its spans belong to the
+	// trace of the request.
+	ctx, span := tracing.Start(tracing.Detach(ctx), "executeStep",
+		attribute.String("step_id", r.ID),
+		attribute.String("kind", r.Kind.String()))
 	go func() {
-		state, outputs, artifact, outputV2, optimizationState, telemetry, stepErr := e.executeStep(r, secrets, client, tiConfig, logConfig)
-		status := StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, Telemetry: telemetry}
+		state, outputs, artifact, outputV2, optimizationState, telemetry, exitCodes, stepErr := e.executeStep(ctx, r, secrets, client, tiConfig, logConfig)
+		if state != nil && state.Exited {
+			span.SetAttributes(attribute.Int("exit_code", state.ExitCode))
+		}
+		tracing.End(span, stepErr)
+		status := StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, Telemetry: telemetry,
+			AttemptExitCodes: exitCodes, Image: e.imageTelemetry(r.ID)}
 		e.mu.Lock()
+		status.Log = e.logResults[r.ID].telemetry
+		status.Nudges = e.logResults[r.ID].nudges
 		e.stepStatus[r.ID] = status
 		channels := e.stepWaitCh[r.ID]
 		e.mu.Unlock()
@@ -178,8 +205,7 @@ func (e *StepExecutor) StreamOutput(ctx context.Context, r *api.StreamOutputRequ
 	return //nolint:nakedret
 }
 
-func (e *StepExecutor) executeStepDrone(r *api.StartStepRequest, tiConfig *tiCfg.Cfg) (*runtime.State, error) {
-	ctx := context.Background()
+func (e *StepExecutor) executeStepDrone(ctx context.Context, r *api.StartStepRequest, tiConfig *tiCfg.Cfg) (*runtime.State, []int, error) {
 	var cancel context.CancelFunc
 	if r.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
@@ -197,19 +223,19 @@ func (e *StepExecutor) executeStepDrone(r *api.StartStepRequest, tiConfig *tiCfg
 	e.stepLog[r.ID] = stepLog
 	e.mu.Unlock()
 
-	runStep := func() (*runtime.State, error) {
+	runStep := func() (*runtime.State, []int, error) {
 		defer cancel()
 
 		r.Kind = api.Run // only this kind is supported
 
-		exited, _, _, _, _, _, err := e.run(ctx, e.engine, r, stepLog, tiConfig)
+		exited, _, _, _, _, _, exitCodes, err := e.runWithRetry(ctx, r, stepLog, tiConfig)
 		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
 			logr.WithError(err).Warnln("step execution canceled")
-			return nil, ctx.Err()
+			return nil, exitCodes, ctx.Err()
 		}
 		if err != nil {
 			logr.WithError(err).Warnln("step execution failed")
-			return nil, err
+			return nil, exitCodes, err
 		}
 
 		if exited != nil {
@@ -220,27 +246,39 @@ func (e *StepExecutor) executeStepDrone(r *api.StartStepRequest, tiConfig *tiCfg
 			}
 		}
 
-		return exited, nil
+		return exited, exitCodes, nil
 	}
 
 	// if the step is configured as a daemon, it is detached
 	// from the main process and executed separately.
 	if r.Detach {
 		go runStep() // nolint:errcheck
-		return &runtime.State{Exited: false}, nil
+		return &runtime.State{Exited: false}, nil, nil
 	}
 
 	return runStep()
 }
 
-func (e *StepExecutor) executeStep(r *api.StartStepRequest, secrets []string, client logstream.Client, tiConfig *tiCfg.Cfg, logConfig *api.LogConfig) (*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, error) {
+func (e *StepExecutor) executeStep(ctx context.Context, r *api.StartStepRequest, secrets []string, client logstream.Client, tiConfig *tiCfg.Cfg, logConfig *api.LogConfig) (
+	*runtime.State, map[string]string, []byte, []*api.OutputV2, string, *types.TelemetryData, []int, error) {
 	if r.LogDrone {
-		state, err := e.executeStepDrone(r, tiConfig)
-		return state, nil, nil, nil, "", nil, err
+		state, exitCodes, err := e.executeStepDrone(ctx, r, tiConfig)
+		return state, nil, nil, nil, "", nil, exitCodes, err
 	}
 
 	wc := livelog.New(client, r.LogKey, r.Name, getNudges(), logConfig.TrimNewLineSuffix)
-	wr := logstream.NewReplacer(wc, secrets)
+	wc.SetShowTimestamps(logConfig.ShowTimestamps)
+	if logConfig.Limit > 0 {
+		wc.SetLimit(logConfig.Limit)
+	}
+	if logConfig.HeadLimit > 0 {
+		wc.SetHeadLimit(logConfig.HeadLimit)
+	}
+	var rules *logstream.Rules
+	if !logConfig.DisableSecretDetection {
+		rules = pipeline.SecretRules()
+	}
+	wr := logstream.NewReplacerWithRules(wc, secrets, rules)
 	err := wr.Open() // nolint:errcheck
 	if err != nil {
 		logrus.WithError(err).WithField("key", r.LogKey).Errorln("could not open log stream")
@@ -249,44 +287,48 @@ func (e *StepExecutor) executeStep(r *api.StartStepRequest, secrets []string, cl
 	// if the step is configured as a daemon, it is detached
 	// from the main process and executed separately.
 	if r.Detach {
-		go func() {
-			ctx := context.Background()
+		go func(ctx context.Context) {
 			var cancel context.CancelFunc
 			if r.Timeout > 0 {
 				ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
 				defer cancel()
 			}
-			e.run(ctx, e.engine, r, wr, tiConfig) // nolint:errcheck
-			wc.Close()
-		}()
-		return &runtime.State{Exited: false}, nil, nil, nil, "", nil, nil
+			e.runWithRetry(ctx, r, wr, tiConfig) // nolint:errcheck
+			closeLogStream(ctx, wr, r.LogKey)    // nolint:errcheck
+		}(ctx)
+		return &runtime.State{Exited: false}, nil, nil, nil, "", nil, nil, nil
 	}
 
 	var result error
 
-	ctx := context.Background()
 	var cancel context.CancelFunc
 	if r.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
 		defer cancel()
 	}
 
-	exited, outputs, artifact, outputV2, optimizationState, telemetry, err := e.run(ctx, e.engine, r, wr, tiConfig)
+	exited, outputs, artifact, outputV2, optimizationState, telemetry, exitCodes, err := e.runWithRetry(ctx, r, wr, tiConfig)
 	if err != nil {
 		result = multierror.Append(result, err)
 	}
 
 	// close the stream. If the session is a remote session, the
 	// full log buffer is uploaded to the remote server.
-	if err = wc.Close(); err != nil {
+	if err = closeLogStream(ctx, wr, r.LogKey); err != nil {
 		result = multierror.Append(result, err)
 	}
+	e.mu.Lock()
+	e.logResults[r.ID] = logResult{
+		telemetry: logTelemetry(wc, wr, client, r.LogKey),
+		nudges:    convertNudges(wc.Nudges()),
+	}
+	e.mu.Unlock()
 
 	// if the context was canceled and returns a canceled or
 	// DeadlineExceeded error this indicates the step was timed out.
 	switch ctx.Err() {
 	case context.Canceled, context.DeadlineExceeded:
-		return nil, nil, nil, nil, "", telemetry, ctx.Err()
+		return nil, nil, nil, nil, "", telemetry, exitCodes, ctx.Err()
 	}
 
 	if exited != nil {
@@ -302,7 +344,7 @@ func (e *StepExecutor) executeStep(r *api.StartStepRequest, secrets []string, cl
 			logrus.WithField("id", r.ID).Infof("received exit code %d\n", exited.ExitCode)
 		}
 	}
-	return exited, outputs, artifact, outputV2, optimizationState, telemetry, result
+	return exited, outputs, artifact, outputV2, optimizationState, telemetry, exitCodes, result
 }
 
 func (e *StepExecutor) run(ctx context.Context, engine *engine.Engine, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) (
@@ -313,9 +355,75 @@ func (e *StepExecutor) run(ctx context.Context, engine *engine.Engine, r *api.St
 	if r.Kind == api.RunTestsV2 {
 		return executeRunTestsV2Step(ctx, engine, r, out, tiConfig)
 	}
+	if r.Kind == api.Build {
+		return executeBuildStep(ctx, engine, r, out)
+	}
+	if r.Kind == api.Plugin {
+		return executePluginStep(ctx, engine, r, out, tiConfig)
+	}
+	if r.Kind == api.Action || r.Kind == api.Bitrise {
+		return executeHostPluginStep(ctx, engine, r, out)
+	}
 	return executeRunTestStep(ctx, engine, r, out, tiConfig)
 }
 
+// closeLogStream closes the log stream of the step, uploading the
+// full logs.
+func closeLogStream(ctx context.Context, wr logstream.Writer, key string) error {
+	_, span := tracing.Start(ctx, "log.upload", attribute.String("key", key))
+	err := wr.Close()
+	tracing.End(span, err)
+	return err
+}
+
+// imageTelemetry returns the telemetry of the image the step ran
+// with, or nil if the step did not run in a container.
+func (e *StepExecutor) imageTelemetry(id string) *api.ImageTelemetry {
+	if e.engine == nil {
+		return nil
+	}
+	info := e.engine.ImageInfo(id)
+	if info == nil {
+		return nil
+	}
+	return &api.ImageTelemetry{
+		Image:          info.Image,
+		Platform:       info.Platform,
+		Digest:         info.Digest,
+		Pulled:         info.Pulled,
+		PullDurationMs: info.PullDuration.Milliseconds(),
+		PullBytes:      info.PullBytes,
+		PullLayers:     info.PullLayers,
+	}
+}
+
+func logTelemetry(wc *livelog.Writer, wr logstream.Writer, client logstream.Client, key string) *api.LogTelemetry {
+	lines, bytes := wc.Truncated()
+	return &api.LogTelemetry{
+		MaskedSecrets:  logstream.Masked(wr),
+		TruncatedLines: lines,
+		TruncatedBytes: bytes,
+		SinkErrors:     logstream.SinkErrors(client, key),
+	}
+}
+
+func convertNudges(matches []livelog.NudgeMatch) []*api.Nudge {
+	var nudges []*api.Nudge
+	for _, m := range matches {
+		nudge := &api.Nudge{
+			Resolution: m.Nudge.GetResolution(),
+			Severity:   m.Nudge.GetSeverity(),
+			Line:       m.Line.Number + 1,
+			Log:        m.Line.Message,
+		}
+		if err := m.Nudge.GetError(); err != nil {
+			nudge.Error = err.Error()
+		}
+		nudges = append(nudges, nudge)
+	}
+	return nudges
+}
+
 func convertStatus(status StepStatus) *api.PollStepResponse {
 	r := &api.PollStepResponse{
 		Exited:            true,
@@ -324,6 +432,11 @@ func convertStatus(status StepStatus) *api.PollStepResponse {
 		OutputV2:          status.OutputV2,
 		OptimizationState: status.OptimizationState,
 		Telemetry:         status.Telemetry,
+		Attempts:          len(status.AttemptExitCodes),
+		AttemptExitCodes:  status.AttemptExitCodes,
+		Image:             status.Image,
+		Log:               status.Log,
+		Nudges:            status.Nudges,
 	}
 
 	stepErr := status.StepErr
@@ -0,0 +1,28 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/harness/harness-docker-runner/logstream"
+)
+
+// secretRules are the credential rules masked in the logs.
+var secretRules = logstream.DefaultRules()
+
+// LoadSecretRules loads the credential rules masked in the logs
+// from the file at path.
+func LoadSecretRules(path string) error {
+	rules, err := logstream.LoadRules(path)
+	if err != nil {
+		return err
+	}
+	secretRules = rules
+	return nil
+}
+
+// SecretRules returns the credential rules masked in the logs.
+func SecretRules() *logstream.Rules {
+	return secretRules
+}
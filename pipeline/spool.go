@@ -0,0 +1,114 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/logstream/spool"
+)
+
+// logSpool stores the logs that could not be delivered to the log
+// service. It is nil if spooling is disabled.
+var logSpool *spool.Spool
+
+// StartLogSpool spools undelivered logs in dir and replays them in
+// the background until the context is canceled.
+func StartLogSpool(ctx context.Context, dir string) error {
+	s, err := spool.New(dir, dialLogSpool)
+	if err != nil {
+		return err
+	}
+	logSpool = s
+	go s.Start(ctx)
+	return nil
+}
+
+// LogSpoolStats returns the size of the log spool, or nil if
+// spooling is disabled.
+func LogSpoolStats() *spool.Stats {
+	if logSpool == nil {
+		return nil
+	}
+	stats := logSpool.Stats()
+	return &stats
+}
+
+// spoolCredentials holds the credentials of the spooled log configs,
+// by spool target. The credentials are kept in memory only, so the
+// logs spooled before a restart are delivered once a stage with the
+// same log config registers its credentials.
+var spoolCredentials = struct {
+	sync.Mutex
+	m map[string]logCredentials
+}{m: map[string]logCredentials{}}
+
+// logCredentials are the secrets of a log config, which are not
+// stored in the spool.
+type logCredentials struct {
+	Token           string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// spoolLogStreamClient wraps the client of the sink so that the
+// logs it fails to deliver are spooled. Logs stored on the runner
+// are not spooled.
+func spoolLogStreamClient(sink string, client logstream.Client, cfg *api.LogConfig) logstream.Client {
+	if logSpool == nil || sink == api.LogSinkFile {
+		return client
+	}
+	// the spooled logs are delivered to this sink only.
+	target := *cfg
+	target.Sinks = []string{sink}
+	creds := stripCredentials(&target)
+	data, err := json.Marshal(&target)
+	if err != nil {
+		return client
+	}
+	spoolCredentials.Lock()
+	spoolCredentials.m[string(data)] = creds
+	spoolCredentials.Unlock()
+	return logSpool.Wrap(client, data)
+}
+
+// dialLogSpool returns the client of a spooled log config.
+func dialLogSpool(target []byte) (logstream.Client, error) {
+	cfg := new(api.LogConfig)
+	if err := json.Unmarshal(target, cfg); err != nil {
+		return nil, err
+	}
+	spoolCredentials.Lock()
+	creds, ok := spoolCredentials.m[string(target)]
+	spoolCredentials.Unlock()
+	if !ok {
+		return nil, errors.New("no credentials for the spooled log config, waiting for a stage with the same log config")
+	}
+	cfg.Token = creds.Token
+	if cfg.S3 != nil {
+		cfg.S3.SecretAccessKey = creds.SecretAccessKey
+		cfg.S3.SessionToken = creds.SessionToken
+	}
+	return newSinkClient(logSinks(cfg)[0], cfg)
+}
+
+// stripCredentials removes the secrets from the log config and
+// returns them.
+func stripCredentials(cfg *api.LogConfig) logCredentials {
+	creds := logCredentials{Token: cfg.Token}
+	cfg.Token = ""
+	if cfg.S3 != nil {
+		s3 := *cfg.S3
+		creds.SecretAccessKey, creds.SessionToken = s3.SecretAccessKey, s3.SessionToken
+		s3.SecretAccessKey, s3.SessionToken = "", ""
+		cfg.S3 = &s3
+	}
+	return creds
+}
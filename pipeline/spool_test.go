@@ -0,0 +1,63 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harness/harness-docker-runner/api"
+	"github.com/harness/harness-docker-runner/logstream"
+	"github.com/harness/harness-docker-runner/logstream/remote"
+	"github.com/harness/harness-docker-runner/logstream/spool"
+)
+
+func TestSpoolCredentials(t *testing.T) {
+	dir := t.TempDir()
+	s, err := spool.New(dir, dialLogSpool)
+	assert.Nil(t, err)
+	logSpool = s
+	defer func() { logSpool = nil }()
+
+	cfg := &api.LogConfig{URL: "http://localhost:8079", AccountID: "account", Token: "secret-token"}
+	client := spoolLogStreamClient(api.LogSinkRemote, failingClient{}, cfg)
+	assert.Nil(t, client.Upload(context.Background(), "key", []*logstream.Line{{Message: "hello\n"}}))
+	assert.Equal(t, "secret-token", cfg.Token)
+
+	// the spooled upload references the log config without its
+	// credentials.
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.upload"))
+	assert.Len(t, matches, 1)
+	data, err := os.ReadFile(matches[0])
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "secret-token")
+
+	var entry struct {
+		Target json.RawMessage `json:"target"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &entry))
+	dialed, err := dialLogSpool(entry.Target)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-token", dialed.(*remote.HTTPClient).Token)
+
+	// the credentials of a log config that was not registered since
+	// the runner started are unknown.
+	_, err = dialLogSpool([]byte(`{"url":"http://localhost:8079","account_id":"other","sinks":["remote"]}`))
+	assert.NotNil(t, err)
+}
+
+type failingClient struct {
+	logstream.Client
+}
+
+func (failingClient) Upload(context.Context, string, []*logstream.Line) error {
+	return errors.New("log service unavailable")
+}
@@ -5,12 +5,18 @@
 package pipeline
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	"github.com/harness/harness-docker-runner/api"
 	"github.com/harness/harness-docker-runner/engine/spec"
 	"github.com/harness/harness-docker-runner/logstream"
 	"github.com/harness/harness-docker-runner/logstream/filestore"
 	"github.com/harness/harness-docker-runner/logstream/remote"
+	"github.com/harness/harness-docker-runner/logstream/s3"
 	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -18,6 +24,13 @@ const (
 	SharedVolName = "_engine"
 )
 
+// LogStorePath is the directory logs are stored in if no log service
+// is configured, set from the runner configuration. It must not be
+// inside SharedVolPath, which is mounted into every step container.
+// Earlier versions wrote the streamed lines of each key to a file
+// directly under SharedVolPath, which are not migrated.
+var LogStorePath = "/var/lib/harness-docker-runner/logs"
+
 // State stores the pipeline state.
 type State struct {
 	volumes   []*spec.Volume
@@ -26,6 +39,11 @@ type State struct {
 	secrets   []string
 	logClient logstream.Client
 	network   string
+
+	portsMu  sync.Mutex
+	ports    []int
+	portEnvs map[string]string
+	bindings map[string]map[string]string // by step id
 }
 
 func NewState() *State {
@@ -59,16 +77,82 @@ func (s *State) AppendSecrets(secrets []string) {
 
 func (s *State) GetLogStreamClient() logstream.Client {
 	if s.logClient == nil {
-		if s.logConfig.URL != "" {
-			s.logClient = remote.NewHTTPClient(s.logConfig.URL, s.logConfig.AccountID,
-				s.logConfig.Token, s.logConfig.IndirectUpload, false)
-		} else {
-			s.logClient = filestore.New(SharedVolPath)
-		}
+		s.logClient = newLogStreamClient(&s.logConfig)
 	}
 	return s.logClient
 }
 
+// newLogStreamClient returns the client of the log config. If more
+// than one sink is selected, the logs are written to each of them.
+func newLogStreamClient(cfg *api.LogConfig) logstream.Client {
+	var sinks []logstream.Sink
+	for _, name := range logSinks(cfg) {
+		client, err := newSinkClient(name, cfg)
+		if err != nil {
+			logrus.WithError(err).WithField("sink", name).Errorln("skipping log sink")
+			continue
+		}
+		sinks = append(sinks, logstream.Sink{Name: name, Client: spoolLogStreamClient(name, client, cfg)})
+	}
+	switch len(sinks) {
+	case 0:
+		return filestore.New(LogStorePath)
+	case 1:
+		return sinks[0].Client
+	}
+	return logstream.NewMultiClient(sinks...)
+}
+
+// logSinks returns the sinks selected in the log config. If none
+// is selected, the logs are archived in the object store if it is
+// configured, else sent to the log service if it is configured,
+// else stored on the runner.
+func logSinks(cfg *api.LogConfig) []string {
+	switch {
+	case len(cfg.Sinks) != 0:
+		return cfg.Sinks
+	case hasS3(cfg):
+		return []string{api.LogSinkS3}
+	case cfg.URL != "":
+		return []string{api.LogSinkRemote}
+	}
+	return []string{api.LogSinkFile}
+}
+
+// newSinkClient returns the client of the sink.
+func newSinkClient(name string, cfg *api.LogConfig) (logstream.Client, error) {
+	switch name {
+	case api.LogSinkS3:
+		if !hasS3(cfg) {
+			return nil, errors.New("no bucket configured")
+		}
+		return s3.New(s3.Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			Prefix:          cfg.S3.Prefix,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			SessionToken:    cfg.S3.SessionToken,
+			PathStyle:       cfg.S3.PathStyle,
+		}), nil
+	case api.LogSinkRemote:
+		if cfg.URL == "" {
+			return nil, errors.New("no log service url configured")
+		}
+		client := remote.NewHTTPClient(cfg.URL, cfg.AccountID, cfg.Token, cfg.IndirectUpload, false)
+		client.Compress = cfg.Compress
+		return client, nil
+	case api.LogSinkFile:
+		return filestore.New(LogStorePath), nil
+	}
+	return nil, fmt.Errorf("unknown log sink %q", name)
+}
+
+func hasS3(cfg *api.LogConfig) bool {
+	return cfg.S3 != nil && cfg.S3.Bucket != ""
+}
+
 func (s *State) GetTIConfig() *tiCfg.Cfg {
 	return &s.tiConfig
 }
@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/harness/harness-docker-runner/config"
 	"github.com/sirupsen/logrus"
@@ -63,6 +64,16 @@ func GitInstalled(instanceInfo InstanceInfo) (installed bool) {
 
 func PluginInstalled(instanceInfo InstanceInfo) (installed bool) {
 	logrus.Infoln("checking plugin is installed")
+	if _, err := PluginPath(instanceInfo); err != nil {
+		logrus.Infoln(err)
+		return false
+	}
+	return true
+}
+
+// PluginPath returns the path of the plugin binary. An error is
+// returned if the binary is not in PATH or fails its health check.
+func PluginPath(instanceInfo InstanceInfo) (string, error) {
 	plugin := "plugin"
 	switch instanceInfo.osType {
 	case windowsString:
@@ -71,37 +82,43 @@ func PluginInstalled(instanceInfo InstanceInfo) (installed bool) {
 
 	path, err := exec.LookPath(plugin)
 	if err != nil {
-		logrus.Infoln("plugin binary not found in PATH")
-		return false
+		return "", fmt.Errorf("plugin binary not found in PATH")
 	}
 	cmd := exec.Command(path, "healthz")
-	if err := cmd.Run(); err != nil {
-		logrus.Infof("Error running plugin healthz: %v\n", err)
-		return false
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("plugin binary %s is not healthy: %v: %s", path, err, strings.TrimSpace(string(out)))
 	}
-	return true
+	return path, nil
 }
 
 func EnvmanInstalled(instanceInfo InstanceInfo) (installed bool) {
 	logrus.Infoln("checking envman is installed")
+	if _, err := EnvmanPath(instanceInfo); err != nil {
+		logrus.Infoln(err)
+		return false
+	}
+	return true
+}
+
+// EnvmanPath returns the path of the envman binary. An error is
+// returned if the binary is not in PATH or cannot be executed.
+func EnvmanPath(instanceInfo InstanceInfo) (string, error) {
 	envman := "envman"
 	switch instanceInfo.osType {
 	case windowsString:
 		//envman doesn't exist for windows
-		return
+		return "", fmt.Errorf("envman is not supported on windows")
 	}
 
 	path, err := exec.LookPath(envman)
 	if err != nil {
-		logrus.Infoln("envman binary not found in PATH")
-		return false
+		return "", fmt.Errorf("envman binary not found in PATH")
 	}
 	cmd := exec.Command(path, "version")
-	if err := cmd.Run(); err != nil {
-		logrus.Infof("Error running envman version: %v\n", err)
-		return false
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("envman binary %s is not healthy: %v: %s", path, err, strings.TrimSpace(string(out)))
 	}
-	return true
+	return path, nil
 }
 
 func DockerInstalled(instanceInfo InstanceInfo) (installed bool) {
@@ -0,0 +1,182 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package tracing traces the execution of the stages and steps
+// with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/harness/harness-docker-runner"
+
+// Exporters the spans can be sent to.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config configures the export of the spans.
+type Config struct {
+	// Exporter is the exporter of the spans, otlp or stdout.
+	// Tracing is disabled if empty.
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector. The
+	// OTEL_EXPORTER_OTLP_* environment variables are used if empty.
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// SampleRatio is the ratio of the traces sampled.
+	SampleRatio float64
+	// Version is the version of the runner.
+	Version string
+}
+
+// Init installs the tracer provider and the W3C trace context
+// propagator. The returned function flushes the pending spans and
+// must be called before the runner exits.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("harness-docker-runner"),
+		semconv.ServiceVersion(cfg.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := newProvider(cfg.SampleRatio,
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// helper function returns a tracer provider that samples the given
+// ratio of the traces, whose root spans are in the trace of their
+// correlation id, if any.
+func newProvider(ratio float64, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(append(opts,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithIDGenerator(newIDGenerator()),
+	)...)
+}
+
+// Start starts a span with the given name, which is a child of the
+// span of the context, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if id, ok := ctx.Value(correlationKey{}).(string); ok && !trace.SpanContextFromContext(ctx).IsValid() {
+		attrs = append(attrs, attribute.String("correlation_id", id))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, recording the error if not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach returns a context that carries the span of ctx but is not
+// canceled with it, for work that outlives the request.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a context whose root span is in a trace
+// derived from the correlation id, so that the requests of a stage
+// sent without trace context still share a trace. The trace of ctx,
+// if any, takes precedence. Whether the trace is sampled is left to
+// the sampler.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// idGenerator generates random ids, except for the trace id of the
+// root spans with a correlation id, which is derived from it.
+type idGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newIDGenerator() *idGenerator {
+	var seed int64
+	binary.Read(crand.Reader, binary.LittleEndian, &seed)     // nolint:errcheck
+	return &idGenerator{rand: rand.New(rand.NewSource(seed))} // nolint:gosec
+}
+
+// NewIDs returns the ids of a root span.
+func (g *idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	var traceID trace.TraceID
+	if id, ok := ctx.Value(correlationKey{}).(string); ok {
+		sum := sha256.Sum256([]byte(id))
+		copy(traceID[:], sum[:16])
+	} else {
+		g.mu.Lock()
+		g.rand.Read(traceID[:]) // nolint:errcheck
+		g.mu.Unlock()
+	}
+	return traceID, g.NewSpanID(ctx, traceID)
+}
+
+// NewSpanID returns the id of a span.
+func (g *idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var spanID trace.SpanID
+	g.rand.Read(spanID[:]) // nolint:errcheck
+	return spanID
+}
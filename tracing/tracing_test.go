@@ -0,0 +1,87 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithCorrelationID(t *testing.T) {
+	setProvider(t, 1)
+	start := func(ctx context.Context, id string) trace.SpanContext {
+		_, span := Start(WithCorrelationID(ctx, id), "test")
+		defer span.End()
+		return span.SpanContext()
+	}
+	a := start(context.Background(), "stage-1")
+	b := start(context.Background(), "stage-1")
+	c := start(context.Background(), "stage-2")
+	if !a.IsValid() || a.IsRemote() || !a.IsSampled() {
+		t.Fatalf("want a valid local sampled span context, got %v", a)
+	}
+	if a.TraceID() != b.TraceID() || a.SpanID() == b.SpanID() {
+		t.Errorf("want distinct spans of the same trace for the same correlation id, got %v and %v", a, b)
+	}
+	if a.TraceID() == c.TraceID() {
+		t.Errorf("want different traces for different correlation ids")
+	}
+	if d := start(context.Background(), ""); d.TraceID() == a.TraceID() || !d.IsValid() {
+		t.Errorf("want a random trace without correlation id, got %v", d)
+	}
+
+	// the sampling of the traces of the correlation ids is left
+	// to the sampler.
+	setProvider(t, 0)
+	if sc := start(context.Background(), "stage-1"); sc.TraceID() != a.TraceID() || sc.IsSampled() {
+		t.Errorf("want the trace of the correlation id not sampled, got %v", sc)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	setProvider(t, 1)
+
+	var got trace.SpanContext
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the trace of the request takes precedence over the
+		// correlation id.
+		_, span := Start(WithCorrelationID(r.Context(), "stage-1"), "test")
+		defer span.End()
+		got = span.SpanContext()
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/step", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := "4bf92f3577b34da6a3ce929d0e0e4736"; got.TraceID().String() != want {
+		t.Errorf("want trace %s, got %s", want, got.TraceID())
+	}
+}
+
+// setProvider installs a tracer provider that samples the ratio of
+// the traces, and the propagators, until the test ends.
+func setProvider(t *testing.T, ratio float64) {
+	if _, err := Init(context.Background(), Config{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := otel.GetTracerProvider()
+	provider := newProvider(ratio)
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background()) // nolint:errcheck
+		otel.SetTracerProvider(prev)
+	})
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	if _, err := Init(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Errorf("want error for unknown exporter")
+	}
+}